@@ -103,6 +103,18 @@ module.exports = function(grunt) {
                         ext: '.css'
                     }
                 ]
+            },
+            // each theme's stylesheet, linked after app.css
+            themes: {
+                files: [
+                    {
+                        expand: true,
+                        cwd: 'assets/src/themes/',
+                        src: '*.scss',
+                        dest: 'assets/build/themes/',
+                        ext: '.css'
+                    }
+                ]
             }
         },
         cssmin: {
@@ -120,6 +132,16 @@ module.exports = function(grunt) {
                         'assets/build/css/**/*.css'
                     ]
                 }
+            },
+            themes: {
+                files: [
+                    {
+                        expand: true,
+                        cwd: 'assets/build/themes/',
+                        src: '*.css',
+                        dest: 'src/goalbum/templates/themes/'
+                    }
+                ]
             }
         }
     });
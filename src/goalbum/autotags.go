@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+const (
+	AutoTagFolder      = "folder"
+	AutoTagDate        = "date"
+	AutoTagCamera      = "camera"
+	AutoTagLens        = "lens"
+	AutoTagOrientation = "orientation"
+	AutoTagMonochrome  = "monochrome"
+)
+
+var (
+	// autoTaggers are the enabled automatic taggers
+	autoTaggers = []string{}
+
+	// images at least this many times wider than high, or higher than
+	// wide, are panoramas
+	panoramaRatio = 2.0
+
+	// images within this ratio of square are square
+	squareRatio = 1.05
+
+	// images whose average saturation is below this are monochrome
+	monochromeSaturation = 0.04
+)
+
+// SetAutoTaggers enables the automatic taggers given as a comma
+// separated string
+func SetAutoTaggers(str string) error {
+	taggers := []string{}
+	for _, tagger := range strings.Split(str, ",") {
+		tagger = strings.TrimSpace(tagger)
+		switch tagger {
+		case AutoTagFolder, AutoTagDate, AutoTagCamera, AutoTagLens, AutoTagOrientation, AutoTagMonochrome:
+			taggers = append(taggers, tagger)
+		case "":
+		default:
+			return fmt.Errorf("Invalid auto tagger %s, expected one of folder, date, camera, lens, orientation, monochrome", tagger)
+		}
+	}
+	autoTaggers = taggers
+	return nil
+}
+
+// SetAutoTags replaces the automatic tags of the photos with those of
+// the enabled taggers. Automatic tags are kept apart from the photo's
+// own tags, and are not saved back to the input images.
+func SetAutoTags(photos []*Photo) {
+	for _, photo := range photos {
+		tags := []string{}
+		for _, tagger := range autoTaggers {
+			var tag string
+			switch tagger {
+			case AutoTagFolder:
+				tag = photo.FolderTag()
+			case AutoTagDate:
+				tag = "Date" + tagSeparator + photo.CreatedAt.Format("2006") + tagSeparator + photo.CreatedAt.Format("01")
+			case AutoTagCamera:
+				tag = autoTag("Camera", photo.CameraModel)
+			case AutoTagLens:
+				tag = autoTag("Lens", photo.LensModel)
+			case AutoTagOrientation:
+				tag = autoTag("Orientation", photo.OrientationClass())
+			case AutoTagMonochrome:
+				if photo.Monochrome {
+					tag = "Monochrome"
+				}
+			}
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		photo.AutoTags = tags
+	}
+}
+
+// autoTag returns the tag value under parent, or an empty string if
+// the value is empty. Tag separators in value are replaced.
+func autoTag(parent, value string) string {
+	value = strings.TrimSpace(strings.Replace(value, tagSeparator, "-", -1))
+	if value == "" {
+		return ""
+	}
+	return parent + tagSeparator + value
+}
+
+// FolderTag returns a tag of the photo's directory relative to the input
+// directory, with a level for each sub-directory, or an empty string if
+// the photo is directly in, or outside of, the input directory
+func (photo *Photo) FolderTag() string {
+	dir := photo.InDir()
+	if dir == "" {
+		return ""
+	}
+	return "Folder" + tagSeparator + dir
+}
+
+// OrientationClass returns panorama, square, landscape or portrait from
+// the dimensions of the original image, or an empty string if they are
+// unknown
+func (photo *Photo) OrientationClass() string {
+	if photo.OriginalWidth == 0 || photo.OriginalHeight == 0 {
+		return ""
+	}
+	ratio := float64(photo.OriginalWidth) / float64(photo.OriginalHeight)
+	switch {
+	case ratio >= panoramaRatio || ratio <= 1/panoramaRatio:
+		return "panorama"
+	case ratio <= squareRatio && ratio >= 1/squareRatio:
+		return "square"
+	case ratio > 1:
+		return "landscape"
+	default:
+		return "portrait"
+	}
+}
+
+// IsMonochrome reports whether the average saturation of the pixels of
+// img, taken as the difference of their largest and smallest color
+// channels, is below monochromeSaturation
+func IsMonochrome(img image.Image) bool {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return false
+	}
+
+	var total float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			max, min := r, r
+			for _, c := range []uint32{g, b} {
+				if c > max {
+					max = c
+				}
+				if c < min {
+					min = c
+				}
+			}
+			total += float64(max-min) / 0xffff
+		}
+	}
+	return total/float64(bounds.Dx()*bounds.Dy()) < monochromeSaturation
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// photos from one camera taken within burstGap of each other are
+	// considered a single burst when suggesting clock offsets
+	burstGap = 10 * time.Second
+
+	// bursts from two cameras within burstTolerance of each other are
+	// considered the same moment
+	burstTolerance = 2 * time.Minute
+
+	// offsets larger than this are not suggested
+	maxClockOffset = 24 * time.Hour
+
+	// the number of fullest bins of burst differences scored when
+	// aligning bursts
+	alignCandidates = 10
+)
+
+// ClockOffset is a correction added to the capture times of photos from
+// a camera. Empty Make, Model or Serial match any camera.
+type ClockOffset struct {
+	Make   string
+	Model  string
+	Serial string
+	Offset time.Duration
+}
+
+// ParseClockOffset parses a clock offset formatted as
+// make|model|serial=duration, for example Canon|Canon EOS 7D|=-1h3m
+func ParseClockOffset(str string) (ClockOffset, error) {
+	var c ClockOffset
+
+	parts := strings.SplitN(str, "=", 2)
+	if len(parts) != 2 {
+		return c, fmt.Errorf("Invalid clock offset %s, expected make|model|serial=duration", str)
+	}
+
+	camera := strings.Split(parts[0], "|")
+	if len(camera) > 3 {
+		return c, fmt.Errorf("Invalid clock offset camera %s, expected make|model|serial", parts[0])
+	}
+	for len(camera) < 3 {
+		camera = append(camera, "")
+	}
+	c.Make = strings.TrimSpace(camera[0])
+	c.Model = strings.TrimSpace(camera[1])
+	c.Serial = strings.TrimSpace(camera[2])
+
+	offset, err := time.ParseDuration(strings.TrimPrefix(strings.TrimSpace(parts[1]), "+"))
+	if err != nil {
+		return c, err
+	}
+	c.Offset = offset
+
+	return c, nil
+}
+
+// ReadClockOffsets reads a file of clock offsets, one per line. Blank
+// lines and text following a # are ignored.
+func ReadClockOffsets(path string) ([]ClockOffset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	offsets := []ClockOffset{}
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum += 1
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		c, err := ParseClockOffset(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %s", path, lineNum, err.Error())
+		}
+		offsets = append(offsets, c)
+	}
+
+	return offsets, scanner.Err()
+}
+
+func (c ClockOffset) String() string {
+	return fmt.Sprintf("%s|%s|%s=%s", c.Make, c.Model, c.Serial, c.Offset)
+}
+
+// Matches is true if each non-empty camera field of the clock offset
+// matches the photo
+func (c ClockOffset) Matches(photo *Photo) bool {
+	return clockFieldMatches(c.Make, photo.CameraMake) &&
+		clockFieldMatches(c.Model, photo.CameraModel) &&
+		clockFieldMatches(c.Serial, photo.CameraSerial)
+}
+
+// Specificity is the number of non-empty camera fields
+func (c ClockOffset) Specificity() int {
+	n := 0
+	for _, field := range []string{c.Make, c.Model, c.Serial} {
+		if field != "" {
+			n += 1
+		}
+	}
+	return n
+}
+
+func clockFieldMatches(want, got string) bool {
+	return want == "" || strings.EqualFold(want, strings.TrimSpace(got))
+}
+
+// ApplyClockOffsets adds the most specific matching clock offset to the
+// capture time of each photo. Later offsets win over earlier offsets
+// which are as specific.
+func ApplyClockOffsets(photos []*Photo, offsets []ClockOffset) {
+	for _, photo := range photos {
+		var match *ClockOffset
+		for i, c := range offsets {
+			if c.Matches(photo) && (match == nil || c.Specificity() >= match.Specificity()) {
+				match = &offsets[i]
+			}
+		}
+		if match != nil && match.Offset != 0 {
+			photo.CreatedAt = photo.CreatedAt.Add(match.Offset)
+			photo.ClockOffset = match.Offset.String()
+		}
+	}
+}
+
+// ClockOffsetSuggestion is a suggested clock offset for a camera
+// relative to the reference camera, with the number of its bursts
+// which were aligned with bursts of the reference camera
+type ClockOffsetSuggestion struct {
+	ClockOffset
+	Aligned int
+	Bursts  int
+}
+
+// SuggestClockOffsets suggests clock offsets for each camera relative
+// to the camera with the most photos, by finding the offset which lines
+// up the most bursts of photos from both cameras. The reference camera
+// is returned along with the suggestions.
+func SuggestClockOffsets(photos []*Photo) (ClockOffset, []ClockOffsetSuggestion) {
+	cameras := map[ClockOffset][]*Photo{}
+	for _, photo := range photos {
+		key := ClockOffset{Make: photo.CameraMake, Model: photo.CameraModel, Serial: photo.CameraSerial}
+		cameras[key] = append(cameras[key], photo)
+	}
+
+	keys := []ClockOffset{}
+	for key := range cameras {
+		keys = append(keys, key)
+	}
+	sort.Sort(byCamera(keys))
+
+	var ref ClockOffset
+	for _, key := range keys {
+		if len(cameras[key]) > len(cameras[ref]) {
+			ref = key
+		}
+	}
+	refBursts := Bursts(cameras[ref])
+
+	suggestions := []ClockOffsetSuggestion{}
+	for _, key := range keys {
+		if key == ref {
+			continue
+		}
+		bursts := Bursts(cameras[key])
+		offset, aligned := AlignBursts(refBursts, bursts)
+		key.Offset = offset
+		suggestions = append(suggestions, ClockOffsetSuggestion{key, aligned, len(bursts)})
+	}
+
+	return ref, suggestions
+}
+
+// Bursts returns the sorted start times of bursts of photos
+func Bursts(photos []*Photo) []time.Time {
+	times := make([]time.Time, len(photos))
+	for i, photo := range photos {
+		times[i] = photo.CreatedAt
+	}
+	sort.Sort(byTime(times))
+
+	bursts := []time.Time{}
+	for i, t := range times {
+		if i == 0 || t.Sub(times[i-1]) > burstGap {
+			bursts = append(bursts, t)
+		}
+	}
+	return bursts
+}
+
+// AlignBursts finds the offset which, added to bursts, lines up the
+// most of them with refBursts. The differences between bursts are
+// counted in bins of burstTolerance, and only the offsets of the fullest
+// bins are scored. The offset is the median difference of the aligned
+// bursts, rounded to the second.
+func AlignBursts(refBursts, bursts []time.Time) (time.Duration, int) {
+	bins := map[time.Duration]int{}
+	for _, b := range bursts {
+		// reference bursts within maxClockOffset of b
+		start := sort.Search(len(refBursts), func(i int) bool {
+			return !refBursts[i].Before(b.Add(-maxClockOffset))
+		})
+		for _, r := range refBursts[start:] {
+			d := r.Sub(b)
+			if d > maxClockOffset {
+				break
+			}
+			bins[d.Round(burstTolerance)]++
+		}
+	}
+
+	candidates := []time.Duration{}
+	for d := range bins {
+		candidates = append(candidates, d)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		ci, cj := bins[candidates[i]], bins[candidates[j]]
+		if ci != cj {
+			return ci > cj
+		}
+		return absDuration(candidates[i]) < absDuration(candidates[j])
+	})
+	if len(candidates) > alignCandidates {
+		candidates = candidates[:alignCandidates]
+	}
+
+	var best time.Duration
+	bestAligned := 0
+	for _, d := range candidates {
+		aligned := len(alignedDiffs(refBursts, bursts, d))
+		if aligned > bestAligned || (aligned == bestAligned && absDuration(d) < absDuration(best)) {
+			best = d
+			bestAligned = aligned
+		}
+	}
+	if bestAligned == 0 {
+		return 0, 0
+	}
+
+	diffs := alignedDiffs(refBursts, bursts, best)
+	sort.Sort(byDuration(diffs))
+	median := diffs[len(diffs)/2]
+
+	return median.Round(time.Second), bestAligned
+}
+
+// alignedDiffs returns, for each burst which falls within burstTolerance
+// of a reference burst after adding offset, the difference between the
+// nearest reference burst and the burst
+func alignedDiffs(refBursts, bursts []time.Time, offset time.Duration) []time.Duration {
+	diffs := []time.Duration{}
+	for _, b := range bursts {
+		shifted := b.Add(offset)
+		i := sort.Search(len(refBursts), func(i int) bool {
+			return !refBursts[i].Before(shifted)
+		})
+		found := false
+		var diff time.Duration
+		for _, j := range []int{i - 1, i} {
+			if j < 0 || j >= len(refBursts) {
+				continue
+			}
+			d := refBursts[j].Sub(b)
+			if absDuration(d-offset) <= burstTolerance && (!found || absDuration(d-offset) < absDuration(diff-offset)) {
+				diff = d
+				found = true
+			}
+		}
+		if found {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+type byCamera []ClockOffset
+
+func (p byCamera) Len() int {
+	return len(p)
+}
+
+func (p byCamera) Swap(i, j int) {
+	p[i], p[j] = p[j], p[i]
+}
+
+func (p byCamera) Less(i, j int) bool {
+	return p[i].String() < p[j].String()
+}
+
+type byTime []time.Time
+
+func (p byTime) Len() int {
+	return len(p)
+}
+
+func (p byTime) Swap(i, j int) {
+	p[i], p[j] = p[j], p[i]
+}
+
+func (p byTime) Less(i, j int) bool {
+	return p[i].Before(p[j])
+}
+
+type byDuration []time.Duration
+
+func (p byDuration) Len() int {
+	return len(p)
+}
+
+func (p byDuration) Swap(i, j int) {
+	p[i], p[j] = p[j], p[i]
+}
+
+func (p byDuration) Less(i, j int) bool {
+	return p[i] < p[j]
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/namsral/flag"
+)
+
+// persistedFlags returns the flags which are saved as album settings in
+// photos.json, keyed by flag name
+func persistedFlags() map[string]interface{} {
+	return map[string]interface{}{
+		"in":             inFlag,
+		"title":          titleFlag,
+		"subtitle":       subtitleFlag,
+		"color":          colorFlag,
+		"head-content":   headContentFlag,
+		"body-content":   bodyContentFlag,
+		"template-dir":   templateDirFlag,
+		"theme":          themeFlag,
+		"include":        &includeFlag,
+		"max-thumb":      maxThumbFlag,
+		"max-slide":      maxSlideFlag,
+		"copy-xmp":       copyXmpFlag,
+		"copy-icc":       copyIccFlag,
+		"timezone":       timezoneFlag,
+		"date-sources":   dateSourcesFlag,
+		"date-layout":    &dateLayoutFlag,
+		"auto-tags":      autoTagsFlag,
+		"sort":           sortFlag,
+		"group":          groupFlag,
+		"event-gap":      eventGapFlag,
+		"event-distance": eventDistFlag,
+		"per-page":       perPageFlag,
+	}
+}
+
+// pathFlags returns the persisted flags which are paths, so they can be
+// made absolute before being saved
+func pathFlags() []*string {
+	paths := []*string{inFlag, headContentFlag, bodyContentFlag, templateDirFlag}
+	for i := range includeFlag {
+		paths = append(paths, &includeFlag[i])
+	}
+	return paths
+}
+
+// AbsPathFlags makes the path flags absolute, relative to the working
+// directory, so the saved settings work from any directory
+func AbsPathFlags() error {
+	for _, p := range pathFlags() {
+		if *p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(*p)
+		if err != nil {
+			return err
+		}
+		*p = abs
+	}
+	return nil
+}
+
+// ApplyAlbumConfig sets persisted flags which were not given explicitly
+// from the album settings saved in photos.json
+func ApplyAlbumConfig(config map[string]json.RawMessage) error {
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for name, value := range persistedFlags() {
+		raw, ok := config[name]
+		if !ok || explicit[name] {
+			continue
+		}
+		err := json.Unmarshal(raw, value)
+		if err != nil {
+			return fmt.Errorf("Invalid album setting %s: %s", name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// AlbumConfigJson returns the current value of persisted flags as json
+func AlbumConfigJson() ([]byte, error) {
+	return json.MarshalIndent(persistedFlags(), "", "    ")
+}
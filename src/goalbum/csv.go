@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	csvHeader = []string{"id", "filename", "thumbnail", "caption", "author", "tags", "date", "md5sum"}
+
+	// tags are joined into a single column, with separators and escapes
+	// within tags escaped
+	csvTagSeparator = ";"
+	csvTagEscape    = "\\"
+
+	// cells starting with a formula prefix are escaped, so spreadsheets
+	// don't evaluate captions such as =HYPERLINK(...)
+	csvFormulaPrefixes = "=+-@"
+	csvFormulaEscape   = "'"
+
+	// spreadsheets need a byte order mark to recognize utf-8
+	utf8Bom = []byte("\xef\xbb\xbf")
+)
+
+// WritePhotosCsv writes one row per photo, for editing captions, authors
+// and tags in a spreadsheet. The thumbnail and date columns are
+// informational only.
+func WritePhotosCsv(w io.Writer, photos []*Photo) error {
+	_, err := w.Write(utf8Bom)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	err = cw.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+	for _, photo := range photos {
+		row := []string{
+			photo.Id,
+			photo.InPath,
+			photo.ThumbPath,
+			photo.Caption,
+			photo.Author,
+			JoinTags(photo.Tags),
+			photo.CreatedAt.Format(time.RFC3339),
+			photo.Md5sum,
+		}
+		for i := range row {
+			row[i] = csvEscapeCell(row[i])
+		}
+		err = cw.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ExportCsv writes the photos as csv to path, or to stdout if path is -
+func ExportCsv(path string, photos []*Photo) error {
+	if path == "-" {
+		return WritePhotosCsv(os.Stdout, photos)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = WritePhotosCsv(f, photos)
+	cerr := f.Close()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
+
+// CsvRowError is an invalid row of an imported csv file
+type CsvRowError struct {
+	Line int
+	Err  string
+}
+
+func (e CsvRowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// ImportCsv reads captions, authors and tags from the csv file at path
+// into the matching photos, by md5sum, or else by id and file name, as
+// ids change when photos are added or sorted differently. Every row is
+// validated before any photo is changed, and all invalid rows are
+// returned.
+func ImportCsv(path string, photos []*Photo) ([]CsvRowError, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, lines, err := csvRecords(bytes.TrimPrefix(data, utf8Bom))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+
+	// columns may be reordered, but must all be present
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"caption", "author", "tags"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%s has no %s column", path, name)
+		}
+	}
+	_, hasId := columns["id"]
+	_, hasMd5sum := columns["md5sum"]
+	if !hasId && !hasMd5sum {
+		return nil, fmt.Errorf("%s has no id or md5sum column", path)
+	}
+	column := func(row []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(csvUnescapeCell(row[i]))
+		}
+		return ""
+	}
+
+	rowErrors := []CsvRowError{}
+	updates := map[*Photo][]string{}
+	for i, row := range rows[1:] {
+		line := lines[i+1]
+		if len(row) != len(rows[0]) {
+			rowErrors = append(rowErrors, CsvRowError{line, fmt.Sprintf("expected %d columns, got %d", len(rows[0]), len(row))})
+			continue
+		}
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			// blank row
+			continue
+		}
+
+		var photo *Photo
+		if md5sum := column(row, "md5sum"); md5sum != "" {
+			photo = FindPhotoByMd5sum(photos, md5sum)
+			if photo == nil {
+				rowErrors = append(rowErrors, CsvRowError{line, fmt.Sprintf("unknown photo md5sum %q", md5sum)})
+				continue
+			}
+		} else {
+			id := column(row, "id")
+			photo = FindPhotoById(photos, id)
+			if photo == nil {
+				rowErrors = append(rowErrors, CsvRowError{line, fmt.Sprintf("unknown photo id %q", id)})
+				continue
+			}
+			if filename := column(row, "filename"); filename != "" && filename != photo.InPath {
+				rowErrors = append(rowErrors, CsvRowError{line, fmt.Sprintf("photo id %q is now %s, not %s", id, photo.InPath, filename)})
+				continue
+			}
+		}
+		if _, ok := updates[photo]; ok {
+			rowErrors = append(rowErrors, CsvRowError{line, fmt.Sprintf("duplicate photo %s", photo.InPath)})
+			continue
+		}
+		updates[photo] = row
+	}
+
+	if len(rowErrors) > 0 {
+		return rowErrors, nil
+	}
+
+	for photo, row := range updates {
+		photo.Caption = csvUnescapeCell(row[columns["caption"]])
+		photo.Author = column(row, "author")
+		photo.Tags = SplitTags(column(row, "tags"))
+	}
+
+	return nil, nil
+}
+
+// csvRecords reads the records of csv data, along with the line each
+// record starts on, as quoted fields may span lines. A record ends at
+// the first line break outside of quotes.
+func csvRecords(data []byte) ([][]string, []int, error) {
+	rows := [][]string{}
+	lines := []int{}
+
+	var record []byte
+	start, quotes := 0, 0
+	for i, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(record) == 0 {
+			start = i + 1
+		}
+		record = append(record, line...)
+		quotes += bytes.Count(line, []byte(`"`))
+		if quotes%2 != 0 && len(line) > 0 && line[len(line)-1] == '\n' {
+			continue
+		}
+
+		row, err := csv.NewReader(bytes.NewReader(record)).Read()
+		record, quotes = nil, 0
+		if err == io.EOF {
+			// blank line
+			continue
+		}
+		if perr, ok := err.(*csv.ParseError); ok {
+			return nil, nil, fmt.Errorf("line %d: %s", start+perr.Line-1, perr.Err.Error())
+		} else if err != nil {
+			return nil, nil, err
+		}
+		rows = append(rows, row)
+		lines = append(lines, start)
+	}
+	return rows, lines, nil
+}
+
+// csvIsFormula returns true if spreadsheets would evaluate the cell as
+// a formula
+func csvIsFormula(cell string) bool {
+	return cell != "" && strings.ContainsAny(cell[:1], csvFormulaPrefixes)
+}
+
+// csvEscapeCell prefixes cells which would be evaluated as a formula
+// with a quote, so spreadsheets show them as text
+func csvEscapeCell(cell string) string {
+	if csvIsFormula(cell) {
+		return csvFormulaEscape + cell
+	}
+	return cell
+}
+
+// csvUnescapeCell removes the quote added by csvEscapeCell
+func csvUnescapeCell(cell string) string {
+	if unescaped := strings.TrimPrefix(cell, csvFormulaEscape); unescaped != cell && csvIsFormula(unescaped) {
+		return unescaped
+	}
+	return cell
+}
+
+// JoinTags joins tags into a csv tags column, escaping separators and
+// escapes within tags
+func JoinTags(tags []string) string {
+	escaped := []string{}
+	for _, tag := range tags {
+		tag = strings.Replace(tag, csvTagEscape, csvTagEscape+csvTagEscape, -1)
+		tag = strings.Replace(tag, csvTagSeparator, csvTagEscape+csvTagSeparator, -1)
+		escaped = append(escaped, tag)
+	}
+	return strings.Join(escaped, csvTagSeparator+" ")
+}
+
+// SplitTags splits a csv tags column into tags, see JoinTags
+func SplitTags(str string) []string {
+	tags := []string{}
+	add := func(tag string) {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !SliceContainsString(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	var tag strings.Builder
+	escaped := false
+	for _, r := range str {
+		switch {
+		case escaped:
+			tag.WriteRune(r)
+			escaped = false
+		case string(r) == csvTagEscape:
+			escaped = true
+		case string(r) == csvTagSeparator:
+			add(tag.String())
+			tag.Reset()
+		default:
+			tag.WriteRune(r)
+		}
+	}
+	add(tag.String())
+	return tags
+}
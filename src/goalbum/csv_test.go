@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// importCsvString imports csv content into the photos
+func importCsvString(t *testing.T, content string, photos []*Photo) ([]CsvRowError, error) {
+	dir, err := ioutil.TempDir("", "goalbum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "photos.csv")
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ImportCsv(path, photos)
+}
+
+func csvTestPhotos() []*Photo {
+	return []*Photo{
+		{Id: "photo-a", InPath: "2016/a.jpg", Md5sum: "aaa"},
+		{Id: "photo-b", InPath: "2016/b.jpg", Md5sum: "bbb"},
+	}
+}
+
+func TestTagsRoundTrip(t *testing.T) {
+	tags := []string{"a;b", `back\slash`, `trailing\`, "plain"}
+	joined := JoinTags(tags)
+	if joined != `a\;b; back\\slash; trailing\\; plain` {
+		t.Errorf("unexpected joined tags %s", joined)
+	}
+	if split := SplitTags(joined); !tagsEqual(split, tags) {
+		t.Errorf("expected tags %q, got %q", tags, split)
+	}
+}
+
+func TestImportCsvMatching(t *testing.T) {
+	photos := csvTestPhotos()
+	rowErrors, err := importCsvString(t, strings.Join([]string{
+		"id,filename,caption,author,tags,md5sum",
+		"photo-x,2016/x.jpg,By md5sum,,,bbb",
+		"photo-a,2016/a.jpg,By id,,,",
+	}, "\n"), photos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rowErrors) != 0 {
+		t.Fatalf("unexpected errors %v", rowErrors)
+	}
+	if photos[0].Caption != "By id" || photos[1].Caption != "By md5sum" {
+		t.Errorf("unexpected captions %q and %q", photos[0].Caption, photos[1].Caption)
+	}
+}
+
+func TestImportCsvRowErrors(t *testing.T) {
+	photos := csvTestPhotos()
+	rowErrors, err := importCsvString(t, strings.Join([]string{
+		"id,filename,caption,author,tags,md5sum",
+		`photo-a,2016/a.jpg,"A caption`,
+		`spanning lines",,,`,
+		"",
+		"photo-b,2016/a.jpg,Moved,,,",
+		"photo-x,,Unknown,,,",
+		"photo-b,,Unknown md5sum,,,ccc",
+		"photo-b,2016/b.jpg,Too short",
+		"photo-a,2016/a.jpg,Duplicate,,,",
+	}, "\r\n"), photos)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []int{5, 6, 7, 8, 9}
+	if len(rowErrors) != len(expected) {
+		t.Fatalf("expected errors on lines %v, got %v", expected, rowErrors)
+	}
+	for i, line := range expected {
+		if rowErrors[i].Line != line {
+			t.Errorf("expected error on line %d, got %v", line, rowErrors[i])
+		}
+	}
+	if photos[0].Caption != "" {
+		t.Errorf("expected no changes, got caption %q", photos[0].Caption)
+	}
+}
+
+func TestCsvFormulaCells(t *testing.T) {
+	photos := csvTestPhotos()
+	photos[0].Caption = `=HYPERLINK("http://example.com/")`
+	photos[0].Author = "@someone"
+	photos[0].Tags = []string{"-1", "+1"}
+	photos[1].Caption = "'quoted"
+
+	var b bytes.Buffer
+	err := WritePhotosCsv(&b, photos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"'=HYPERLINK(""http://example.com/"")"`, ",'@someone,", ",'-1; +1,", ",'quoted,"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("expected csv to contain %s, got %s", want, b.String())
+		}
+	}
+
+	imported := csvTestPhotos()
+	rowErrors, err := importCsvString(t, b.String(), imported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rowErrors) != 0 {
+		t.Fatalf("unexpected errors %v", rowErrors)
+	}
+	for i := range photos {
+		if imported[i].Caption != photos[i].Caption || imported[i].Author != photos[i].Author || !tagsEqual(imported[i].Tags, photos[i].Tags) {
+			t.Errorf("expected %q %q %q, got %q %q %q", photos[i].Caption, photos[i].Author, photos[i].Tags,
+				imported[i].Caption, imported[i].Author, imported[i].Tags)
+		}
+	}
+}
+
+func TestImportCsvParseError(t *testing.T) {
+	_, err := importCsvString(t, "id,caption,author,tags\nphoto-a,\"a\nb\",,\nphoto-b,\"a\"b,,\n", csvTestPhotos())
+	if err == nil || !strings.HasPrefix(err.Error(), "line 4:") {
+		t.Errorf("expected an error on line 4, got %v", err)
+	}
+}
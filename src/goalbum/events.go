@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"time"
+)
+
+const GroupEvent = "event"
+
+var (
+	// consecutive photos further apart than eventGap are in different
+	// events
+	eventGap = 3 * time.Hour
+
+	// if not 0, consecutive photos with gps positions further apart than
+	// eventDistance kilometres are in different events
+	eventDistance = 0.0
+
+	// eventTitles are the titles of events by id, as edited in photos.json
+	eventTitles = map[string]string{}
+
+	earthRadiusKm = 6371.0
+)
+
+// SetEvents sets the time gap and distance which separate events, and
+// the edited event titles
+func SetEvents(gap time.Duration, distance float64, titles map[string]string) error {
+	if gap <= 0 {
+		return fmt.Errorf("Invalid event gap %s, expected a positive duration", gap)
+	}
+	if distance < 0 {
+		return fmt.Errorf("Invalid event distance %g, expected a positive number of kilometres", distance)
+	}
+	eventGap = gap
+	eventDistance = distance
+	eventTitles = titles
+	if eventTitles == nil {
+		eventTitles = map[string]string{}
+	}
+	return nil
+}
+
+// GroupEvents splits photos into events wherever consecutive photos were
+// captured more than eventGap apart, or were taken more than
+// eventDistance apart. Events keep the id of the titled event most of
+// their photos were in before, otherwise they are identified by the
+// capture time of their first photo. Events are titled with their edited
+// title, or their date range and folder. The event of each photo is set
+// to the id of its section.
+func GroupEvents(photos []*Photo) []*PhotoSection {
+	sections := []*PhotoSection{}
+	var section *PhotoSection
+	for i, photo := range photos {
+		if section == nil || isEventBoundary(photos[i-1], photo) {
+			section = &PhotoSection{
+				Label:  photo.CreatedAt.Format(groupLayouts[GroupDay][2]),
+				Photos: []*Photo{},
+			}
+			sections = append(sections, section)
+		}
+		section.Photos = append(section.Photos, photo)
+	}
+
+	// titled events keep their id as photos are added, or their capture
+	// times change
+	ids := map[string]bool{}
+	for _, section := range sections {
+		if id := previousEvent(section.Photos, ids); id != "" {
+			section.Id = id
+			ids[id] = true
+		}
+	}
+	for _, section := range sections {
+		if section.Id != "" {
+			continue
+		}
+		key := section.Photos[0].CreatedAt.Format("20060102-150405")
+		id := "event-" + key
+		for n := 2; ids[id]; n++ {
+			id = fmt.Sprintf("event-%s-%d", key, n)
+		}
+		section.Id = id
+		ids[id] = true
+	}
+
+	for _, section := range sections {
+		section.Title = eventTitles[section.Id]
+		if section.Title == "" {
+			section.Title = EventTitle(section.Photos)
+		}
+		for _, photo := range section.Photos {
+			photo.Event = section.Id
+		}
+	}
+	return sections
+}
+
+// previousEvent returns the id of the titled event which most of the
+// photos were in, other than the used ids, or an empty string if none of
+// them were in one
+func previousEvent(photos []*Photo, used map[string]bool) string {
+	counts := map[string]int{}
+	for _, photo := range photos {
+		if photo.Event != "" && eventTitles[photo.Event] != "" && !used[photo.Event] {
+			counts[photo.Event]++
+		}
+	}
+	best := ""
+	for id, count := range counts {
+		if best == "" || count > counts[best] || (count == counts[best] && id < best) {
+			best = id
+		}
+	}
+	return best
+}
+
+func isEventBoundary(p1, p2 *Photo) bool {
+	gap := p2.CreatedAt.Sub(p1.CreatedAt)
+	if gap < 0 {
+		gap = -gap
+	}
+	if gap > eventGap {
+		return true
+	}
+	if eventDistance > 0 && p1.LocationSource != "" && p2.LocationSource != "" {
+		return distanceKm(p1.Latitude, p1.Longitude, p2.Latitude, p2.Longitude) > eventDistance
+	}
+	return false
+}
+
+// EventTitle returns the date range of the photos, followed by their
+// folder if they are all in the same sub-directory of the input
+// directory, such as "11 - 13 October 2016, Paris"
+func EventTitle(photos []*Photo) string {
+	if len(photos) == 0 {
+		return ""
+	}
+	start, end := photos[0].CreatedAt, photos[0].CreatedAt
+	folder := photoFolder(photos[0])
+	for _, photo := range photos[1:] {
+		if photo.CreatedAt.Before(start) {
+			start = photo.CreatedAt
+		}
+		if photo.CreatedAt.After(end) {
+			end = photo.CreatedAt
+		}
+		if photoFolder(photo) != folder {
+			folder = ""
+		}
+	}
+
+	var title string
+	switch {
+	case start.Format("2006-01-02") == end.Format("2006-01-02"):
+		title = start.Format(groupLayouts[GroupDay][1])
+	case start.Format("2006-01") == end.Format("2006-01"):
+		title = start.Format("2") + " - " + end.Format("2 January 2006")
+	case start.Year() == end.Year():
+		title = start.Format("2 January") + " - " + end.Format("2 January 2006")
+	default:
+		title = start.Format("2 January 2006") + " - " + end.Format("2 January 2006")
+	}
+	if folder != "" {
+		title += ", " + folder
+	}
+	return title
+}
+
+// photoFolder returns the name of the photo's directory, or an empty
+// string if it is directly in, or outside of, the input directory
+func photoFolder(photo *Photo) string {
+	dir := photo.InDir()
+	if dir == "" {
+		return ""
+	}
+	return path.Base(dir)
+}
+
+// EventTitlesJson returns the titles to save in photos.json: the edited
+// titles, along with an empty title for each of the sections, to be
+// filled in
+func EventTitlesJson(sections []*PhotoSection) map[string]string {
+	titles := map[string]string{}
+	for id, title := range eventTitles {
+		if title != "" {
+			titles[id] = title
+		}
+	}
+	for _, section := range sections {
+		if _, ok := titles[section.Id]; !ok {
+			titles[section.Id] = ""
+		}
+	}
+	return titles
+}
+
+// distanceKm returns the great circle distance between two positions
+func distanceKm(lat1, long1, lat2, long2 float64) float64 {
+	toRad := func(deg float64) float64 {
+		return deg * math.Pi / 180
+	}
+	dLat := toRad(lat2 - lat1)
+	dLong := toRad(long2 - long1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
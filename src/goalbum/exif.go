@@ -1,15 +1,67 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// exif fields which goexif does not load by default
+const (
+	OffsetTime          exif.FieldName = "OffsetTime"
+	OffsetTimeOriginal  exif.FieldName = "OffsetTimeOriginal"
+	OffsetTimeDigitized exif.FieldName = "OffsetTimeDigitized"
+	BodySerialNumber    exif.FieldName = "BodySerialNumber"
 )
 
 var (
 	exiftoolName = "exiftool"
+
+	extraExifFields = map[uint16]exif.FieldName{
+		0x9010: OffsetTime,
+		0x9011: OffsetTimeOriginal,
+		0x9012: OffsetTimeDigitized,
+		0xA431: BodySerialNumber,
+	}
 )
 
+type extraExifParser struct{}
+
+// Parse loads the fields in extraExifFields from the exif sub-IFD
+func (p *extraExifParser) Parse(x *exif.Exif) error {
+	tag, err := x.Get(exif.ExifIFDPointer)
+	if err != nil {
+		return nil
+	}
+	offset, err := tag.Int64(0)
+	if err != nil {
+		return nil
+	}
+	r := bytes.NewReader(x.Raw)
+	_, err = r.Seek(offset, 0)
+	if err != nil {
+		return nil
+	}
+	subDir, _, err := tiff.DecodeDir(r, x.Tiff.Order)
+	if err != nil {
+		return nil
+	}
+	x.LoadTags(subDir, extraExifFields, false)
+	return nil
+}
+
+func init() {
+	exif.RegisterParsers(&extraExifParser{})
+}
+
 func ExiftoolPath(toolPath string) (myPath string, err error) {
 	if toolPath == "" {
 		// provided path is empty, search PATH, it is not an error
@@ -43,11 +95,96 @@ func ExiftoolPathFind() (myPath string, err error) {
 	return
 }
 
+// Exiftool is a long running exiftool process which reads commands
+// from stdin, so that perl is started once rather than once per photo
+type Exiftool struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	out    *os.File
+	stdout *bufio.Reader
+}
+
+// NewExiftool starts exiftool in -stay_open mode. stderr is sent to the
+// same pipe as stdout, so that the output of each command includes its
+// errors.
+func NewExiftool(toolPath string) (*Exiftool, error) {
+	cmd := exec.Command(toolPath, "-stay_open", "True", "-@", "-")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return &Exiftool{cmd, stdin, r, bufio.NewReader(r)}, nil
+}
+
+// Execute runs a single exiftool command and returns its output. An
+// error is returned if exiftool reports one.
+func (et *Exiftool) Execute(args ...string) (string, error) {
+	var b bytes.Buffer
+	for _, arg := range args {
+		// arguments are newline delimited, values with line breaks should
+		// be escaped with -E
+		if strings.ContainsAny(arg, "\r\n") {
+			fmt.Printf("Warning: replacing line breaks in exiftool argument %q with spaces\n", arg)
+			arg = strings.Replace(strings.Replace(arg, "\r", " ", -1), "\n", " ", -1)
+		}
+		b.WriteString(arg)
+		b.WriteString("\n")
+	}
+	b.WriteString("-execute\n")
+	_, err := et.stdin.Write(b.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	failed := false
+	for {
+		line, err := et.stdout.ReadString('\n')
+		if err != nil {
+			return out.String(), err
+		}
+		if strings.TrimSpace(line) == "{ready}" {
+			break
+		}
+		if strings.HasPrefix(line, "Error") || strings.Contains(line, "due to errors") {
+			failed = true
+		}
+		out.WriteString(line)
+	}
+
+	if failed {
+		return out.String(), fmt.Errorf("exiftool: %s", strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
 // ExifCp copies exif data from src image to dst image.
 // It excludes Orientation tag because the orientation has been
 // normalized in the processed images.
-func ExifCp(toolPath, src, dst string) (string, error) {
-	cmd := exec.Command(toolPath, "-overwrite_original_in_place", "-tagsFromFile", src, "-x", "Orientation", dst)
-	out, err := cmd.CombinedOutput()
-	return string(out), err
+func (et *Exiftool) ExifCp(src, dst string) (string, error) {
+	return et.Execute("-overwrite_original_in_place", "-tagsFromFile", src, "-x", "Orientation", dst)
+}
+
+// Close tells exiftool to exit and waits for it
+func (et *Exiftool) Close() error {
+	_, err := et.stdin.Write([]byte("-stay_open\nFalse\n"))
+	et.stdin.Close()
+	werr := et.cmd.Wait()
+	et.out.Close()
+	if err != nil {
+		return err
+	}
+	return werr
 }
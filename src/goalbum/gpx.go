@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"sort"
+	"time"
+)
+
+// sources of a photo's location
+const (
+	LocationExif = "exif"
+	LocationGpx  = "gpx"
+)
+
+// TrackPoint is a timestamped position from a gpx track log
+type TrackPoint struct {
+	Latitude  float64
+	Longitude float64
+	Time      time.Time
+}
+
+type gpxFile struct {
+	Tracks []struct {
+		Segments []struct {
+			Points []struct {
+				Lat  float64 `xml:"lat,attr"`
+				Lon  float64 `xml:"lon,attr"`
+				Time string  `xml:"time"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// ReadGpx reads the timestamped track points from gpx files, sorted by
+// time. Points without a time are skipped.
+func ReadGpx(paths []string) ([]TrackPoint, error) {
+	points := []TrackPoint{}
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		var gpx gpxFile
+		err = xml.NewDecoder(f).Decode(&gpx)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, trk := range gpx.Tracks {
+			for _, seg := range trk.Segments {
+				for _, pt := range seg.Points {
+					t, err := time.Parse(time.RFC3339, pt.Time)
+					if err != nil {
+						continue
+					}
+					points = append(points, TrackPoint{pt.Lat, pt.Lon, t})
+				}
+			}
+		}
+	}
+
+	sort.Sort(byTrackTime(points))
+	return points, nil
+}
+
+// GeotagPhotos sets the location of photos which have none from the
+// track, interpolating between the points on either side of the capture
+// time plus offset. Photos further than maxGap from the track are left
+// alone.
+func GeotagPhotos(photos []*Photo, track []TrackPoint, offset, maxGap time.Duration) {
+	for _, photo := range photos {
+		if photo.LocationSource != "" {
+			continue
+		}
+		lat, long, ok := TrackPosition(track, photo.CreatedAt.Add(offset), maxGap)
+		if ok {
+			photo.Latitude = lat
+			photo.Longitude = long
+			photo.LocationSource = LocationGpx
+		}
+	}
+}
+
+// TrackPosition returns the position on the track at time t
+func TrackPosition(track []TrackPoint, t time.Time, maxGap time.Duration) (float64, float64, bool) {
+	i := sort.Search(len(track), func(i int) bool {
+		return !track[i].Time.Before(t)
+	})
+
+	var before, after *TrackPoint
+	if i > 0 {
+		before = &track[i-1]
+	}
+	if i < len(track) {
+		after = &track[i]
+	}
+
+	switch {
+	case after != nil && after.Time.Equal(t):
+		return after.Latitude, after.Longitude, true
+	case before != nil && after != nil && after.Time.Sub(before.Time) <= maxGap:
+		frac := float64(t.Sub(before.Time)) / float64(after.Time.Sub(before.Time))
+		return before.Latitude + (after.Latitude-before.Latitude)*frac,
+			before.Longitude + (after.Longitude-before.Longitude)*frac,
+			true
+	}
+
+	// too far between points to interpolate, use the nearest one if
+	// it is close enough
+	var nearest *TrackPoint
+	if before != nil && t.Sub(before.Time) <= maxGap {
+		nearest = before
+	}
+	if after != nil && after.Time.Sub(t) <= maxGap && (nearest == nil || after.Time.Sub(t) < t.Sub(before.Time)) {
+		nearest = after
+	}
+	if nearest == nil {
+		return 0, 0, false
+	}
+	return nearest.Latitude, nearest.Longitude, true
+}
+
+type byTrackTime []TrackPoint
+
+func (p byTrackTime) Len() int {
+	return len(p)
+}
+
+func (p byTrackTime) Swap(i, j int) {
+	p[i], p[j] = p[j], p[i]
+}
+
+func (p byTrackTime) Less(i, j int) bool {
+	return p[i].Time.Before(p[j].Time)
+}
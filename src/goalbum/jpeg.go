@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"regexp"
+)
+
+const (
+	markerSOI  = 0xD8
+	markerEOI  = 0xD9
+	markerSOS  = 0xDA
+	markerAPP1 = 0xE1
+	markerAPP2 = 0xE2
+)
+
+var (
+	exifPrefix        = []byte("Exif\x00\x00")
+	xmpPrefix         = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtendedPrefix = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	iccPrefix         = []byte("ICC_PROFILE\x00")
+
+	xmpOrientationAttr = regexp.MustCompile(`tiff:Orientation="\d"`)
+	xmpOrientationElem = regexp.MustCompile(`<tiff:Orientation>\d</tiff:Orientation>`)
+)
+
+// JpegSegment is a marker segment of a jpeg file. Data does not include
+// the marker or the length bytes.
+type JpegSegment struct {
+	Marker byte
+	Data   []byte
+}
+
+// Bytes returns the segment as it is written to a jpeg file
+func (seg JpegSegment) Bytes() []byte {
+	b := make([]byte, 4, len(seg.Data)+4)
+	b[0] = 0xFF
+	b[1] = seg.Marker
+	binary.BigEndian.PutUint16(b[2:], uint16(len(seg.Data)+2))
+	return append(b, seg.Data...)
+}
+
+func (seg JpegSegment) IsExif() bool {
+	return seg.Marker == markerAPP1 && bytes.HasPrefix(seg.Data, exifPrefix)
+}
+
+func (seg JpegSegment) IsXmp() bool {
+	return seg.Marker == markerAPP1 &&
+		(bytes.HasPrefix(seg.Data, xmpPrefix) || bytes.HasPrefix(seg.Data, xmpExtendedPrefix))
+}
+
+func (seg JpegSegment) IsIcc() bool {
+	return seg.Marker == markerAPP2 && bytes.HasPrefix(seg.Data, iccPrefix)
+}
+
+// JpegSegments returns the marker segments that precede the image data
+// of a jpeg file
+func JpegSegments(data []byte) ([]JpegSegment, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil, fmt.Errorf("Not a jpeg file")
+	}
+
+	segments := []JpegSegment{}
+	i := 2
+	for i < len(data) {
+		if data[i] != 0xFF {
+			return nil, fmt.Errorf("Invalid jpeg marker at offset %d", i)
+		}
+		// skip fill bytes
+		for i < len(data) && data[i] == 0xFF {
+			i += 1
+		}
+		if i >= len(data) {
+			break
+		}
+		marker := data[i]
+		i += 1
+		if marker == markerSOS || marker == markerEOI {
+			break
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			// markers without a payload
+			continue
+		}
+		if i+2 > len(data) {
+			return nil, fmt.Errorf("Truncated jpeg segment at offset %d", i)
+		}
+		length := int(binary.BigEndian.Uint16(data[i:]))
+		if length < 2 || i+length > len(data) {
+			return nil, fmt.Errorf("Invalid jpeg segment length at offset %d", i)
+		}
+		segments = append(segments, JpegSegment{marker, data[i+2 : i+length]})
+		i += length
+	}
+
+	return segments, nil
+}
+
+// MetadataSegments selects the exif, and optionally the xmp and icc,
+// segments to be transplanted from a source jpeg into its renditions.
+// Orientation is reset to 1, since the renditions have already been
+// rotated to match it.
+func MetadataSegments(data []byte, withXmp, withIcc bool) ([]JpegSegment, error) {
+	segments, err := JpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []JpegSegment{}
+	for _, seg := range segments {
+		switch {
+		case seg.IsExif():
+			exifData := make([]byte, len(seg.Data))
+			copy(exifData, seg.Data)
+			err = ResetExifOrientation(exifData[len(exifPrefix):])
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, JpegSegment{seg.Marker, exifData})
+		case seg.IsXmp() && withXmp:
+			xmpData := xmpOrientationAttr.ReplaceAll(seg.Data, []byte(`tiff:Orientation="1"`))
+			xmpData = xmpOrientationElem.ReplaceAll(xmpData, []byte(`<tiff:Orientation>1</tiff:Orientation>`))
+			result = append(result, JpegSegment{seg.Marker, xmpData})
+		case seg.IsIcc() && withIcc:
+			result = append(result, seg)
+		}
+	}
+
+	return result, nil
+}
+
+// ResetExifOrientation sets the Orientation tag of the first image file
+// directory in the tiff encoded exif data to 1, in-place
+func ResetExifOrientation(tiff []byte) error {
+	if len(tiff) < 8 {
+		return fmt.Errorf("Exif data too short")
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return fmt.Errorf("Invalid exif byte order")
+	}
+
+	// compare as uint64, the offset may not fit in an int
+	offset64 := uint64(order.Uint32(tiff[4:]))
+	if offset64 < 8 || offset64+2 > uint64(len(tiff)) {
+		return fmt.Errorf("Invalid exif directory offset")
+	}
+	offset := int(offset64)
+	count := int(order.Uint16(tiff[offset:]))
+	if count*12 > len(tiff)-offset-2 {
+		return fmt.Errorf("Truncated exif directory")
+	}
+	for n := 0; n < count; n++ {
+		entry := offset + 2 + n*12
+		// orientation is a single SHORT stored in the value field
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			order.PutUint16(tiff[entry+8:], 1)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// WriteJpeg encodes img as a jpeg at dst, with segments inserted
+// directly after the start of image marker
+func WriteJpeg(dst string, img image.Image, segments []JpegSegment) error {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, nil)
+	if err != nil {
+		return err
+	}
+
+	encoded := buf.Bytes()
+	var out bytes.Buffer
+	out.Write(encoded[0:2])
+	for _, seg := range segments {
+		out.Write(seg.Bytes())
+	}
+	out.Write(encoded[2:])
+
+	return ioutil.WriteFile(dst, out.Bytes(), 0644)
+}
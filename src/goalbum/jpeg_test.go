@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// exifTiff returns little endian tiff data with a single directory at
+// offset 8 holding an orientation entry
+func exifTiff(orientation uint16) []byte {
+	tiff := []byte("II*\x00")
+	tiff = append(tiff, 8, 0, 0, 0)
+	tiff = append(tiff, 1, 0)
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], 0x0112)
+	binary.LittleEndian.PutUint16(entry[2:], 3)
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	tiff = append(tiff, entry...)
+	return append(tiff, 0, 0, 0, 0)
+}
+
+func TestResetExifOrientation(t *testing.T) {
+	tiff := exifTiff(6)
+	err := ResetExifOrientation(tiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orientation := binary.LittleEndian.Uint16(tiff[18:]); orientation != 1 {
+		t.Errorf("expected orientation 1, got %d", orientation)
+	}
+}
+
+func TestResetExifOrientationMalformed(t *testing.T) {
+	valid := exifTiff(6)
+	withOffset := func(offset uint32) []byte {
+		tiff := append([]byte{}, valid...)
+		binary.LittleEndian.PutUint32(tiff[4:], offset)
+		return tiff
+	}
+	withCount := func(count uint16) []byte {
+		tiff := append([]byte{}, valid...)
+		binary.LittleEndian.PutUint16(tiff[8:], count)
+		return tiff
+	}
+
+	tests := []struct {
+		name string
+		tiff []byte
+	}{
+		{"empty", []byte{}},
+		{"short header", valid[:6]},
+		{"invalid byte order", append([]byte("XX"), valid[2:]...)},
+		{"offset past end", withOffset(uint32(len(valid)))},
+		{"offset overflowing int", withOffset(0xFFFFFFFF)},
+		{"offset into header", withOffset(2)},
+		{"count past end", withCount(0xFFFF)},
+		{"truncated directory", valid[:15]},
+	}
+	for _, test := range tests {
+		err := ResetExifOrientation(test.tiff)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestJpegSegments(t *testing.T) {
+	app1 := append(append([]byte{}, exifPrefix...), exifTiff(6)...)
+	seg := JpegSegment{markerAPP1, app1}
+	data := append([]byte{0xFF, markerSOI}, seg.Bytes()...)
+	data = append(data, 0xFF, markerSOS, 0, 2)
+
+	segments, err := JpegSegments(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 || !segments[0].IsExif() || !bytes.Equal(segments[0].Data, app1) {
+		t.Fatalf("expected a single exif segment, got %v", segments)
+	}
+
+	metadata, err := MetadataSegments(data, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tiff := metadata[0].Data[len(exifPrefix):]
+	if orientation := binary.LittleEndian.Uint16(tiff[18:]); orientation != 1 {
+		t.Errorf("expected orientation 1, got %d", orientation)
+	}
+	if orientation := binary.LittleEndian.Uint16(app1[len(exifPrefix)+18:]); orientation != 6 {
+		t.Errorf("expected source orientation to be unchanged, got %d", orientation)
+	}
+}
+
+func TestJpegSegmentsMalformed(t *testing.T) {
+	truncatedApp1 := []byte{0xFF, markerSOI, 0xFF, markerAPP1, 0x01, 0x00, 'E', 'x'}
+	badTiff := JpegSegment{markerAPP1, append(append([]byte{}, exifPrefix...), "II*\x00\xff\xff\xff\xff"...)}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"not a jpeg", []byte("GIF89a")},
+		{"invalid marker", []byte{0xFF, markerSOI, 0x00, markerAPP1}},
+		{"truncated length", []byte{0xFF, markerSOI, 0xFF, markerAPP1, 0x01}},
+		{"length past end", truncatedApp1},
+		{"length too short", []byte{0xFF, markerSOI, 0xFF, markerAPP1, 0x00, 0x01}},
+		{"malformed exif", append([]byte{0xFF, markerSOI}, badTiff.Bytes()...)},
+	}
+	for _, test := range tests {
+		_, err := MetadataSegments(test.data, true, true)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
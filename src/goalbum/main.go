@@ -1,19 +1,18 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"image/jpeg"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
-	"sort"
 	"strings"
 	"sync"
-	"text/template"
 	"time"
 
 	"github.com/disintegration/imaging"
@@ -22,19 +21,42 @@ import (
 
 // cli args
 var (
-	inFlag          = flag.String("in", "", "The input directory where images can be found")
-	outFlag         = flag.String("out", "", "The output directory where the static gallery will be generated")
-	maxThumbFlag    = flag.Int("max-thumb", 300, "Maximum pixel dimension of thumbnail images")
-	maxSlideFlag    = flag.Int("max-slide", 1200, "Maximum pixel dimension of slide images")
-	titleFlag       = flag.String("title", "", "Title of album")
-	subtitleFlag    = flag.String("subtitle", "", "Subtitle of album")
-	colorFlag       = flag.String("color", "blue", "CSS colors to use (http://materializecss.com/color.html#palette)")
-	headContentFlag = flag.String("head-content", "", "Path to file whose content should be included prior to the closing of the head element")
-	bodyContentFlag = flag.String("body-content", "", "Path to file whose content should be included prior to the closing of the body element")
-	includeFlag     strslice
-	updateFlag      = flag.Bool("update", false, "If output directory is existing gallery, update instead of replace")
-	exiftoolFlag    = flag.String("exiftool", "", "Provide path to exiftool. If empty, PATH will be searched")
-	version         = flag.Bool("version", false, "Show the version and exit.")
+	inFlag           = flag.String("in", "", "The input directory where images can be found, along with optional album.json sidecars. Yaml sidecars are not supported")
+	outFlag          = flag.String("out", "", "The output directory where the static gallery will be generated")
+	maxThumbFlag     = flag.Int("max-thumb", 300, "Maximum pixel dimension of thumbnail images")
+	maxSlideFlag     = flag.Int("max-slide", 1200, "Maximum pixel dimension of slide images")
+	titleFlag        = flag.String("title", "", "Title of album")
+	subtitleFlag     = flag.String("subtitle", "", "Subtitle of album")
+	colorFlag        = flag.String("color", "blue", "CSS colors to use (http://materializecss.com/color.html#palette)")
+	headContentFlag  = flag.String("head-content", "", "Path to file whose content should be included prior to the closing of the head element")
+	bodyContentFlag  = flag.String("body-content", "", "Path to file whose content should be included prior to the closing of the body element")
+	templateDirFlag  = flag.String("template-dir", "", "Directory of .ctmpl files which replace the built in templates of the same name")
+	themeFlag        = flag.String("theme", "default", "Built in theme of the gallery. One of: default, dark, justified, story, print")
+	includeFlag      strslice
+	clockOffsetFlag  strslice
+	dateLayoutFlag   strslice
+	gpxFlag          strslice
+	updateFlag       = flag.Bool("update", false, "If output directory is existing gallery, update instead of replace")
+	exiftoolFlag     = flag.String("exiftool", "", "Provide path to exiftool to copy exif data to original images. If empty, exif data is copied without exiftool")
+	timezoneFlag     = flag.String("timezone", "", "Time zone of capture times recorded without one, e.g. Europe/Paris. If empty, the local time zone is used")
+	dateSourcesFlag  = flag.String("date-sources", "exif,filename,mtime", "Comma separated order of sources for capture times. Any of: exif, filename, sidecar, mtime")
+	sortFlag         = flag.String("sort", "date", "Order of photos in the gallery. One of: date, filename, path, manual. All but manual can be followed by -reverse, e.g. date-reverse")
+	groupFlag        = flag.String("group", "", "Group photos into sections captured on the same day, month or year, or in the same event, with a timeline to navigate them. One of: day, month, year, event")
+	eventGapFlag     = flag.Duration("event-gap", 3*time.Hour, "Minimum time between consecutive photos of different events, when grouping by event")
+	eventDistFlag    = flag.Float64("event-distance", 0, "If not 0, minimum distance in kilometres between consecutive photos of different events, when grouping by event")
+	perPageFlag      = flag.Int("per-page", 0, "Number of photos on each page of the gallery. If 0, all photos are on one page")
+	autoTagsFlag     = flag.String("auto-tags", "", "Comma separated automatic taggers to enable. Any of: folder, date, camera, lens, orientation, monochrome")
+	clockOffsetsFlag = flag.String("clock-offsets", "", "Path to file of camera clock offsets, one make|model|serial=duration per line")
+	suggestClockFlag = flag.Bool("suggest-clock-offsets", false, "Suggest camera clock offsets by aligning bursts of photos from different cameras, then exit")
+	gpxOffsetFlag    = flag.Duration("gpx-offset", 0, "Duration added to capture times when matching photos to gpx tracks")
+	gpxMaxGapFlag    = flag.Duration("gpx-max-gap", 5*time.Minute, "Maximum time between a photo and gpx track points for it to be geotagged")
+	copyXmpFlag      = flag.Bool("copy-xmp", false, "Copy xmp metadata from input images to generated images. Ignored when using exiftool")
+	copyIccFlag      = flag.Bool("copy-icc", false, "Copy icc color profile from input images to generated images. Ignored when using exiftool")
+	exportMetaFlag   = flag.String("export-metadata", "", "Write caption, author and tags from photos.json in the out directory back to the input images, then exit. One of: xmp, exiftool")
+	exportCsvFlag    = flag.String("export-csv", "", "Write the id, file name, thumbnail, caption, author, tags, date and md5sum of each photo in photos.json to a csv file, or - for stdout, then exit")
+	importCsvFlag    = flag.String("import-csv", "", "Read captions, authors and tags from a csv file written by -export-csv into photos.json, then update the gallery")
+	printConfigFlag  = flag.Bool("print-config", false, "Print the effective album configuration, including settings saved in the out directory, then exit")
+	version          = flag.Bool("version", false, "Show the version and exit.")
 )
 
 var (
@@ -45,6 +67,7 @@ var (
 	slidesDirName    = "slides"
 	thumbsDirName    = "thumbs"
 	assetsDirName    = "assets"
+	tagsDirName      = "tags"
 
 	originalsDir string
 	slidesDir    string
@@ -52,6 +75,10 @@ var (
 	assetsDir    string
 
 	concurrency = runtime.NumCPU()
+
+	// inputRoot is the absolute input directory, which photo source
+	// paths are relative to
+	inputRoot string
 )
 
 type strslice []string
@@ -70,23 +97,39 @@ type photoResult struct {
 	err   error
 }
 
+// Page is rendered by the index template. Root is the relative path from
+// the page to the out directory. Photos are shown in sections, grouped
+// by Group, and may be split across PageCount pages. Tag is set on tag
+// pages, TagIndex on the tag index page. Theme provides the page's
+// stylesheets and layout. HeadContent and BodyContent are inserted
+// without escaping. sections are the sections of the whole gallery, see
+// Sections.
 type Page struct {
 	Title        string
 	Subtitle     string
+	Root         string
 	Photos       []*Photo
+	Group        string
+	PageNumber   int
+	PageCount    int
 	CreatedAt    string
 	Color        string
-	HeadContent  string
-	BodyContent  string
-	Tags         map[string]string
+	Theme        *Theme
+	HeadContent  template.HTML
+	BodyContent  template.HTML
+	Tags         []*TagNode
+	TagsJson     template.JS
+	Tag          *TagNode
+	TagIndex     []*TagNode
 	BuildVersion string
 	BuildTime    string
 	BuildHash    string
+	sections     []*PhotoSection
 }
 
 func init() {
 	var err error
-	indexTmpl, err = template.New("index").Parse(string(indexCtmpl))
+	indexTmpl, err = ParseTemplates(theme, "")
 
 	if err != nil {
 		fmt.Printf("Invalid index template: %s\n", err.Error())
@@ -94,13 +137,18 @@ func init() {
 	}
 
 	flag.Var(&includeFlag, "include", "File to include in document root of gallery")
+	flag.Var(&dateLayoutFlag, "date-layout", "Go time layout used to parse capture times from file names without extension, e.g. 2006-01-02_150405")
+	flag.Var(&gpxFlag, "gpx", "Gpx track log used to geotag photos without a gps position")
+	flag.Var(&clockOffsetFlag, "clock-offset", "Camera clock offset, make|model|serial=duration, e.g. Canon|Canon EOS 7D|=-1h3m. Empty fields match any camera")
 
-	// validate static assets are present
+	// validate static assets and theme templates are present
 	missing := []string{}
-	for _, s := range staticAssets {
-		_, err := Asset(s)
-		if err != nil {
-			missing = append(missing, s)
+	for _, name := range ThemeNames() {
+		for _, s := range append(themes[name].Assets, themes[name].Templates...) {
+			_, err := Asset(s)
+			if err != nil {
+				missing = append(missing, s)
+			}
 		}
 	}
 	if len(missing) > 0 {
@@ -117,13 +165,156 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *outFlag == "" {
+		fmt.Println("out directory is required")
+		os.Exit(1)
+	}
+
+	// attempt to parse existing photos.json file
+	photoJsonPath := path.Join(*outFlag, "photos.json")
+	photosJson, err := ReadPhotosJson(photoJsonPath)
+	if err != nil {
+		fmt.Printf("Error parsing existing photo data: %s\n", err.Error())
+		os.Exit(1)
+	}
+	existingPhotos := photosJson.Photos
+
+	err = ApplyAlbumConfig(photosJson.Album)
+	if err != nil {
+		fmt.Printf("Error reading album settings: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	// saved paths are relative to the out directory of a later run
+	err = AbsPathFlags()
+	if err != nil {
+		fmt.Printf("Invalid path: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if *printConfigFlag {
+		data, err := AlbumConfigJson()
+		if err != nil {
+			fmt.Printf("Error converting album config json: %s\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		os.Exit(0)
+	}
+
+	if *inFlag != "" {
+		inputRoot = *inFlag
+	}
+
+	if *exportMetaFlag != "" || *exportCsvFlag != "" {
+		err = CheckSourcePaths(existingPhotos)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if *exportMetaFlag != "" {
+		err = ExportMetadata(existingPhotos, *exportMetaFlag)
+		if err != nil {
+			fmt.Printf("Error exporting metadata: %s\n", err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *exportCsvFlag != "" {
+		err = ExportCsv(*exportCsvFlag, existingPhotos)
+		if err != nil {
+			fmt.Printf("Error exporting csv: %s\n", err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *importCsvFlag != "" {
+		rowErrors, err := ImportCsv(*importCsvFlag, existingPhotos)
+		if err != nil {
+			fmt.Printf("Error importing csv: %s\n", err.Error())
+			os.Exit(1)
+		}
+		if len(rowErrors) > 0 {
+			fmt.Printf("Error importing csv, no changes were made:\n")
+			for _, rowError := range rowErrors {
+				fmt.Printf("%s %s\n", *importCsvFlag, rowError.Error())
+			}
+			os.Exit(1)
+		}
+	}
+
 	if *inFlag == "" {
 		fmt.Println("in directory is required")
 		os.Exit(1)
 	}
 
-	if *outFlag == "" {
-		fmt.Println("out directory is required")
+	err = SetTimezone(*timezoneFlag)
+	if err != nil {
+		fmt.Printf("Invalid timezone: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	err = SetDateSources(*dateSourcesFlag, dateLayoutFlag)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	err = SetSortOrder(*sortFlag)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	err = ValidateGroup(*groupFlag)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	err = SetEvents(*eventGapFlag, *eventDistFlag, photosJson.Events)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	err = SetTheme(*themeFlag)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	indexTmpl, err = ParseTemplates(theme, *templateDirFlag)
+	if err != nil {
+		fmt.Printf("Invalid template: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	headContent, err := ReadContentFile(*headContentFlag)
+	if err != nil {
+		fmt.Printf("Error reading head content: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	bodyContent, err := ReadContentFile(*bodyContentFlag)
+	if err != nil {
+		fmt.Printf("Error reading body content: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	err = SetPhotosPerPage(*perPageFlag)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	err = SetAutoTaggers(*autoTagsFlag)
+	if err != nil {
+		fmt.Println(err.Error())
 		os.Exit(1)
 	}
 
@@ -132,33 +323,63 @@ func main() {
 	thumbsDir = path.Join(*outFlag, thumbsDirName)
 	assetsDir = path.Join(*outFlag, assetsDirName)
 
-	// attempt to parse existing photos.json file
-	var existingPhotos []*Photo
-	photoJsonPath := path.Join(*outFlag, "photos.json")
-	photosBlob, err := ioutil.ReadFile(photoJsonPath)
-	if os.IsNotExist(err) {
-		existingPhotos = []*Photo{}
-	} else {
-		err = json.Unmarshal(photosBlob, &existingPhotos)
+	var photos []*Photo
+	photos, err = IndexPhotos(*inFlag)
+
+	if err != nil {
+		fmt.Printf("Error indexing photos: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if *suggestClockFlag {
+		ref, suggestions := SuggestClockOffsets(photos)
+		fmt.Printf("# offsets relative to %s|%s|%s\n", ref.Make, ref.Model, ref.Serial)
+		for _, s := range suggestions {
+			fmt.Printf("%s # %d of %d bursts aligned\n", s.ClockOffset, s.Aligned, s.Bursts)
+		}
+		os.Exit(0)
+	}
+
+	clockOffsets, err := ClockOffsets()
+	if err != nil {
+		fmt.Printf("Error reading clock offsets: %s\n", err.Error())
+		os.Exit(1)
+	}
+	ApplyClockOffsets(photos, clockOffsets)
+
+	if len(gpxFlag) > 0 {
+		track, err := ReadGpx(gpxFlag)
 		if err != nil {
-			fmt.Printf("Error parsing existing photo data: %s\n", err.Error())
+			fmt.Printf("Error reading gpx: %s\n", err.Error())
 			os.Exit(1)
 		}
+		GeotagPhotos(photos, track, *gpxOffsetFlag, *gpxMaxGapFlag)
 	}
 
-	var photos []*Photo
-	photos, err = IndexPhotos(*inFlag)
-
+	err = ApplyAlbumSidecars(*inFlag, photos)
 	if err != nil {
-		fmt.Printf("Error indexing photos: %s\n", err.Error())
+		fmt.Printf("Error reading album sidecars: %s\n", err.Error())
 		os.Exit(1)
 	}
 
+	// captions of fresh photos default to the file name and date, so
+	// that a caption can be cleared deliberately in photos.json
+	for _, photo := range photos {
+		photo.SetDefaultCaption()
+		photo.SetGenerated()
+	}
+
 	if len(existingPhotos) > 0 {
-		PhotoUpdate(photos, existingPhotos)
+		conflicts := PhotoUpdate(photos, existingPhotos)
+		for _, conflict := range conflicts {
+			fmt.Printf("Conflict: %s\n", conflict)
+		}
 	}
 
-	photosToAdd := PhotoSliceSubtract(photos, existingPhotos)
+	// hidden photos are kept in photos.json, but are not published
+	existingVisible := VisiblePhotos(existingPhotos)
+	photosToAdd := PhotoSliceSubtract(VisiblePhotos(photos), existingVisible)
+	photosToAdd = append(photosToAdd, RenameMovedPhotos(VisiblePhotos(photos), existingVisible)...)
 	var photosToRm []*Photo
 	if *updateFlag {
 		// we are updating an existing gallery
@@ -167,22 +388,18 @@ func main() {
 	} else {
 		// we are replacing existing gallery
 		photos = PhotoRemoveDuplicates(photos)
-		photosToRm = PhotoSliceSubtract(existingPhotos, photos)
+		photosToRm = PhotoSliceSubtract(existingVisible, photos)
 	}
+	photosToRm = append(photosToRm, PhotoIntersect(existingVisible, HiddenPhotos(photos))...)
 
-	sort.Sort(ByCreatedAt(photos))
-	tags := PhotoTags(photos)
-	SetTagNames(photos, tags)
+	SortPhotos(photos)
+	visiblePhotos := VisiblePhotos(photos)
 	err = SetPhotoIds(photos)
 	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
 
-	for _, photo := range photos {
-		photo.SetDefaultCaption()
-	}
-
 	// create out directories
 	for _, dir := range []string{originalsDir, slidesDir, thumbsDir, assetsDir} {
 		err := os.MkdirAll(dir, 0755)
@@ -204,52 +421,69 @@ func main() {
 		}
 	}
 
-	ResizePhotos(photosToAdd)
-
-	err = WriteOriginalExif(photosToAdd)
+	err = ResizePhotos(photosToAdd)
 	if err != nil {
-		fmt.Printf("Writing exif tags: %s\n", err.Error())
+		fmt.Printf("Error resizing photos: %s\n", err.Error())
 		os.Exit(1)
 	}
 
-	f, err := os.Create(path.Join(*outFlag, "index.html"))
+	// automatic tags may depend on the generated images
+	SetAutoTags(photos)
+	tags := PhotoTags(visiblePhotos)
+	SetTagNames(visiblePhotos, tags)
+	cooccurrence := TagCooccurrence(visiblePhotos)
+	tagsJson, err := json.Marshal(cooccurrence)
 	if err != nil {
-		fmt.Printf("Error opening html: %s\n", err.Error())
+		fmt.Printf("Error converting tags json: %s\n", err.Error())
 		os.Exit(1)
 	}
-	defer f.Close()
 
-	w := bufio.NewWriter(f)
-	indexTmpl.Execute(w, Page{
+	page := Page{
 		Title:        *titleFlag,
 		Subtitle:     *subtitleFlag,
-		Photos:       photos,
+		Photos:       visiblePhotos,
+		Group:        *groupFlag,
 		CreatedAt:    time.Now().Format("Monday, January 2, 2006"),
 		Color:        *colorFlag,
-		HeadContent:  *headContentFlag,
-		BodyContent:  *bodyContentFlag,
-		Tags:         tags,
+		Theme:        theme,
+		HeadContent:  headContent,
+		BodyContent:  bodyContent,
+		Tags:         TagTree(tags, cooccurrence),
+		TagsJson:     template.JS(tagsJson),
 		BuildVersion: buildVersion,
 		BuildTime:    buildTime,
 		BuildHash:    buildHash,
-	})
-	w.Flush()
+		sections:     GroupPhotos(visiblePhotos, *groupFlag),
+	}
+	err = WritePages(*outFlag, page)
+	if err != nil {
+		fmt.Printf("Error writing html: %s\n", err.Error())
+		os.Exit(1)
+	}
 
-	for _, staticAsset := range staticAssets {
-		err = writeStaticAsset(assetsDir, staticAsset)
-		if err != nil {
-			fmt.Printf("Error writing static asset %s: %s\n", staticAsset, err.Error())
-			os.Exit(1)
-		}
+	err = WriteManifest(*outFlag, visiblePhotos)
+	if err != nil {
+		fmt.Printf("Error writing photo manifest: %s\n", err.Error())
+		os.Exit(1)
 	}
 
-	data, err := json.MarshalIndent(photos, "", "    ")
+	err = WriteTagPages(path.Join(*outFlag, tagsDirName), page, visiblePhotos, tags)
 	if err != nil {
-		fmt.Printf("Error converting photos json: %s\n", err.Error())
+		fmt.Printf("Error writing tag pages: %s\n", err.Error())
 		os.Exit(1)
 	}
 
-	err = ioutil.WriteFile(photoJsonPath, data, 0644)
+	err = WriteThemeAssets(assetsDir, theme)
+	if err != nil {
+		fmt.Printf("Error writing static asset %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	events := []*PhotoSection{}
+	if page.Group == GroupEvent {
+		events = page.Sections()
+	}
+	err = WritePhotosJson(photoJsonPath, photos, EventTitlesJson(events))
 	if err != nil {
 		fmt.Printf("Error writing photos json: %s\n", err.Error())
 		os.Exit(1)
@@ -265,6 +499,27 @@ func main() {
 	}
 }
 
+// ClockOffsets returns the clock offsets from the -clock-offsets file
+// followed by those from -clock-offset flags
+func ClockOffsets() ([]ClockOffset, error) {
+	offsets := []ClockOffset{}
+	if *clockOffsetsFlag != "" {
+		fileOffsets, err := ReadClockOffsets(*clockOffsetsFlag)
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, fileOffsets...)
+	}
+	for _, str := range clockOffsetFlag {
+		c, err := ParseClockOffset(str)
+		if err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, c)
+	}
+	return offsets, nil
+}
+
 func IndexPhotos(path string) ([]*Photo, error) {
 	photos := []*Photo{}
 	var wg sync.WaitGroup
@@ -315,7 +570,36 @@ func IndexPhotos(path string) ([]*Photo, error) {
 	return photos, err
 }
 
-func ResizePhotos(photos []*Photo) {
+// RenameMovedPhotos renames the generated images of existing photos
+// whose source file has been renamed, so they match the new file name.
+// Photos whose images could not be renamed are returned, so they can be
+// generated again.
+func RenameMovedPhotos(photos, existingPhotos []*Photo) []*Photo {
+	filenames := []string{}
+	for _, photo := range photos {
+		filenames = append(filenames, photo.Filename())
+	}
+
+	failed := []*Photo{}
+	for _, photo := range photos {
+		existing := FindPhotoByMd5sum(existingPhotos, photo.Md5sum)
+		if existing == nil || SliceContainsString(filenames, existing.Filename()) {
+			// not moved, or copied rather than moved
+			continue
+		}
+		for _, dir := range []string{originalsDir, slidesDir, thumbsDir} {
+			err := os.Rename(path.Join(dir, existing.Filename()), path.Join(dir, photo.Filename()))
+			if err != nil {
+				fmt.Printf("Error renaming moved photo %s: %s\n", existing.Filename(), err.Error())
+				failed = append(failed, photo)
+				break
+			}
+		}
+	}
+	return failed
+}
+
+func ResizePhotos(photos []*Photo) error {
 	photoCh := make(chan *Photo, concurrency)
 	doneCh := make(chan bool)
 	errCh := make(chan error)
@@ -323,10 +607,29 @@ func ResizePhotos(photos []*Photo) {
 	var wg sync.WaitGroup
 
 	numPhotos := len(photos)
+	if numPhotos == 0 {
+		return nil
+	}
+
+	// each worker copies exif with its own exiftool process, if requested
+	exiftools := make([]*Exiftool, concurrency)
+	if *exiftoolFlag != "" {
+		exifPath, err := ExiftoolPathValidate(*exiftoolFlag)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < concurrency; i++ {
+			exiftools[i], err = NewExiftool(exifPath)
+			if err != nil {
+				return err
+			}
+			defer exiftools[i].Close()
+		}
+	}
 
 	// start the workers
 	for i := 0; i < concurrency; i++ {
-		go ResizeWorker(i, photoCh, doneCh, errCh, progCh, &wg)
+		go ResizeWorker(i, exiftools[i], photoCh, doneCh, errCh, progCh, &wg)
 	}
 
 	quit := make(chan bool)
@@ -336,7 +639,7 @@ func ResizePhotos(photos []*Photo) {
 		for {
 			select {
 			case err := <-myErrCh:
-				fmt.Printf("Error resizing photo: %s\n", err.Error())
+				fmt.Printf("Error processing photo: %s\n", err.Error())
 			case <-myDoneCh:
 				return
 			}
@@ -375,15 +678,22 @@ func ResizePhotos(photos []*Photo) {
 	close(doneCh)
 	close(errCh)
 	close(progCh)
+
+	return nil
 }
 
-func ResizeWorker(id int, photoCh <-chan *Photo, doneCh <-chan bool, errCh chan<- error, progCh chan<- string, wg *sync.WaitGroup) {
+func ResizeWorker(id int, exiftool *Exiftool, photoCh <-chan *Photo, doneCh <-chan bool, errCh chan<- error, progCh chan<- string, wg *sync.WaitGroup) {
 	for {
 		select {
 		case photo := <-photoCh:
 			err := ResizePhoto(photo)
 			if err != nil {
-				errCh <- err
+				errCh <- fmt.Errorf("%s: %s", photo.SourcePath(), err.Error())
+			} else if exiftool != nil {
+				_, err := exiftool.ExifCp(photo.SourcePath(), path.Join(originalsDir, photo.Filename()))
+				if err != nil {
+					errCh <- fmt.Errorf("%s: %s", photo.SourcePath(), err.Error())
+				}
 			}
 			progCh <- photo.Filename()
 			wg.Done()
@@ -394,35 +704,36 @@ func ResizeWorker(id int, photoCh <-chan *Photo, doneCh <-chan bool, errCh chan<
 }
 
 func ResizePhoto(photo *Photo) error {
-	file, err := os.Open(photo.InPath)
+	data, err := ioutil.ReadFile(photo.SourcePath())
 	if err != nil {
 		return err
 	}
 
 	// decode jpeg into image.Image
-	img, err := jpeg.Decode(file)
+	img, err := jpeg.Decode(bytes.NewReader(data))
 	if err != nil {
 		return err
 	}
-	file.Close()
 
 	// fix orientation
-	orientation, err := GetOrientation(photo.InPath)
+	orientation, err := GetOrientation(photo.SourcePath())
 	if err == nil {
 		FixOrientation(&img, orientation)
 	}
 
-	// write original image
-	original, err := os.Create(path.Join(originalsDir, photo.Filename()))
-	if err != nil {
-		return err
+	// metadata to copy into each image, unless exiftool is used
+	segments := []JpegSegment{}
+	if *exiftoolFlag == "" {
+		segments, err = MetadataSegments(data, *copyXmpFlag, *copyIccFlag)
+		if err != nil {
+			// broken metadata shouldn't keep the photo out of the gallery
+			fmt.Printf("Warning: not copying metadata of %s: %s\n", photo.InPath, err.Error())
+			segments = []JpegSegment{}
+		}
 	}
 
-	err = jpeg.Encode(original, img, nil)
-	if err != nil {
-		return err
-	}
-	err = original.Close()
+	// write original image
+	err = WriteJpeg(path.Join(originalsDir, photo.Filename()), img, segments)
 	if err != nil {
 		return err
 	}
@@ -432,16 +743,7 @@ func ResizePhoto(photo *Photo) error {
 	// write slide image
 	slideImg := imaging.Fit(img, *maxSlideFlag, *maxSlideFlag, imaging.Lanczos)
 
-	slide, err := os.Create(path.Join(slidesDir, photo.Filename()))
-	if err != nil {
-		return err
-	}
-
-	err = jpeg.Encode(slide, slideImg, nil)
-	if err != nil {
-		return err
-	}
-	err = slide.Close()
+	err = WriteJpeg(path.Join(slidesDir, photo.Filename()), slideImg, segments)
 	if err != nil {
 		return err
 	}
@@ -451,21 +753,13 @@ func ResizePhoto(photo *Photo) error {
 	// write thumb image
 	thumbImg := imaging.Fit(img, *maxThumbFlag, *maxThumbFlag, imaging.Lanczos)
 
-	thumb, err := os.Create(path.Join(thumbsDir, photo.Filename()))
-	if err != nil {
-		return err
-	}
-
-	err = jpeg.Encode(thumb, thumbImg, nil)
-	if err != nil {
-		return err
-	}
-	err = thumb.Close()
+	err = WriteJpeg(path.Join(thumbsDir, photo.Filename()), thumbImg, segments)
 	if err != nil {
 		return err
 	}
 	photo.ThumbWidth = thumbImg.Bounds().Dx()
 	photo.ThumbHeight = thumbImg.Bounds().Dy()
+	photo.Monochrome = IsMonochrome(thumbImg)
 
 	return nil
 }
@@ -477,6 +771,13 @@ func IndexPhoto(inPath string) (*Photo, error) {
 	}
 
 	filename := path.Base(absPath)
+	createdAt, createdAtSource, createdAtZone := ImageTimeTaken(absPath)
+	cameraMake, cameraModel, cameraSerial, lensModel := GetCamera(absPath)
+	var locationSource string
+	lat, long, err := GetLatLong(absPath)
+	if err == nil {
+		locationSource = LocationExif
+	}
 
 	md5sum, err := Md5sumFromPath(absPath)
 	if err != nil {
@@ -484,34 +785,20 @@ func IndexPhoto(inPath string) (*Photo, error) {
 	}
 
 	return &Photo{
-		InPath:       absPath,
-		Md5sum:       md5sum,
-		OriginalPath: path.Join(originalsDirName, filename),
-		SlidePath:    path.Join(slidesDirName, filename),
-		ThumbPath:    path.Join(thumbsDirName, filename),
-		CreatedAt:    ImageTimeTaken(absPath),
+		InPath:          RelativeInPath(inputRoot, absPath),
+		Md5sum:          md5sum,
+		OriginalPath:    path.Join(originalsDirName, filename),
+		SlidePath:       path.Join(slidesDirName, filename),
+		ThumbPath:       path.Join(thumbsDirName, filename),
+		CreatedAt:       createdAt,
+		CreatedAtSource: createdAtSource,
+		CreatedAtZone:   createdAtZone,
+		CameraMake:      cameraMake,
+		CameraModel:     cameraModel,
+		CameraSerial:    cameraSerial,
+		LensModel:       lensModel,
+		Latitude:        lat,
+		Longitude:       long,
+		LocationSource:  locationSource,
 	}, nil
 }
-
-func WriteOriginalExif(photos []*Photo) error {
-	exifPath, err := ExiftoolPath(*exiftoolFlag)
-	if err != nil {
-		return err
-	}
-	if exifPath == "" {
-		// exiftool not found
-		return nil
-	}
-	if len(photos) > 0 {
-		fmt.Printf("Updating exif for %d photos...\n", len(photos))
-		for _, photo := range photos {
-			originalPath := path.Join(originalsDir, photo.Filename())
-			out, err := ExifCp(exifPath, photo.InPath, originalPath)
-			if err != nil {
-				fmt.Println(out)
-				return err
-			}
-		}
-	}
-	return nil
-}
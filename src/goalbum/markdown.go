@@ -0,0 +1,114 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	markdownHeading = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	markdownItem    = regexp.MustCompile(`^[-*+]\s+(.*)$`)
+	markdownCode    = regexp.MustCompile("`([^`]+)`")
+	markdownStrong  = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	markdownEm      = regexp.MustCompile(`\*([^*]+)\*`)
+	markdownLink    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+
+	// markdownScheme matches the scheme of absolute urls
+	markdownScheme = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+)
+
+// Markdown converts a small subset of markdown to html: paragraphs,
+// headings, unordered lists, links, inline code, bold and italic text.
+// Html in str is escaped, and links other than relative, http, https
+// and mailto links are left as text.
+func Markdown(str string) string {
+	var b strings.Builder
+	paragraph := []string{}
+	inList := false
+
+	flush := func() {
+		if len(paragraph) > 0 {
+			b.WriteString("<p>" + markdownInline(strings.Join(paragraph, " ")) + "</p>\n")
+			paragraph = []string{}
+		}
+		if inList {
+			b.WriteString("</ul>\n")
+			inList = false
+		}
+	}
+
+	for _, line := range strings.Split(str, "\n") {
+		line = strings.TrimSpace(line)
+		if m := markdownHeading.FindStringSubmatch(line); m != nil {
+			flush()
+			level := strconv.Itoa(len(m[1]))
+			b.WriteString("<h" + level + ">" + markdownInline(m[2]) + "</h" + level + ">\n")
+		} else if m := markdownItem.FindStringSubmatch(line); m != nil {
+			if len(paragraph) > 0 {
+				flush()
+			}
+			if !inList {
+				b.WriteString("<ul>\n")
+				inList = true
+			}
+			b.WriteString("<li>" + markdownInline(m[1]) + "</li>\n")
+		} else if line == "" {
+			flush()
+		} else {
+			if inList {
+				flush()
+			}
+			paragraph = append(paragraph, line)
+		}
+	}
+	flush()
+
+	return b.String()
+}
+
+// markdownSafeUrl returns true if url is relative, or an http, https or
+// mailto url
+func markdownSafeUrl(url string) bool {
+	for _, r := range url {
+		// browsers ignore control characters in urls
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+	scheme := markdownScheme.FindString(url)
+	switch strings.ToLower(scheme) {
+	case "", "http:", "https:", "mailto:":
+		return true
+	}
+	return false
+}
+
+func markdownInline(str string) string {
+	str = html.EscapeString(str)
+	str = markdownCode.ReplaceAllString(str, "<code>$1</code>")
+
+	// link urls are replaced by placeholders until the emphasis is
+	// converted, so asterisks in urls are kept. Escaping leaves no & in
+	// str other than entities, so placeholders can't clash with text.
+	urls := []string{}
+	str = markdownLink.ReplaceAllStringFunc(str, func(link string) string {
+		m := markdownLink.FindStringSubmatch(link)
+		if !markdownSafeUrl(html.UnescapeString(m[2])) {
+			return link
+		}
+		urls = append(urls, m[2])
+		return `<a href="` + markdownUrlPlaceholder(len(urls)-1) + `">` + m[1] + `</a>`
+	})
+	str = markdownStrong.ReplaceAllString(str, "<strong>$1</strong>")
+	str = markdownEm.ReplaceAllString(str, "<em>$1</em>")
+	for i, url := range urls {
+		str = strings.Replace(str, markdownUrlPlaceholder(i), url, 1)
+	}
+	return str
+}
+
+func markdownUrlPlaceholder(i int) string {
+	return "&url" + strconv.Itoa(i) + ";"
+}
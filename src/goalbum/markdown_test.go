@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdownSafeUrl(t *testing.T) {
+	tests := []struct {
+		url  string
+		safe bool
+	}{
+		{"photos/a.jpg", true},
+		{"../index.html", true},
+		{"#section-2016", true},
+		{"http://example.com/", true},
+		{"HTTPS://example.com/", true},
+		{"mailto:someone@example.com", true},
+		{"javascript:alert(1)", false},
+		{"JavaScript:alert(1)", false},
+		{"data:text/html;base64,PHNjcmlwdD4=", false},
+		{"vbscript:msgbox(1)", false},
+		{"\x01javascript:alert(1)", false},
+		{"java\x00script:alert(1)", false},
+		{"java\tscript:alert(1)", false},
+		{"java\nscript:alert(1)", false},
+		{"http://example.com/\x7f", false},
+	}
+	for _, test := range tests {
+		if safe := markdownSafeUrl(test.url); safe != test.safe {
+			t.Errorf("markdownSafeUrl(%q) = %t, expected %t", test.url, safe, test.safe)
+		}
+	}
+}
+
+func TestMarkdownLinks(t *testing.T) {
+	tests := []struct {
+		markdown string
+		expected string
+	}{
+		{"[home](http://example.com/)", `<p><a href="http://example.com/">home</a></p>`},
+		{"[photo](photos/a.jpg)", `<p><a href="photos/a.jpg">photo</a></p>`},
+		{"[x](http://a/_b_)", `<p><a href="http://a/_b_">x</a></p>`},
+		{"*[x](http://a/*b*)* **b**", `<p><em><a href="http://a/*b*">x</a></em> <strong>b</strong></p>`},
+		{"[x](javascript:alert(1))", `<p>[x](javascript:alert(1))</p>`},
+		{"[x](data:text/html;base64,PHNjcmlwdD4=)", `<p>[x](data:text/html;base64,PHNjcmlwdD4=)</p>`},
+		{"[x](\x01javascript:alert(1))", "<p>[x](\x01javascript:alert(1))</p>"},
+		{`[x](http://example.com/"onclick="alert(1))`, `<p><a href="http://example.com/&#34;onclick=&#34;alert(1">x</a>)</p>`},
+	}
+	for _, test := range tests {
+		actual := strings.TrimSpace(Markdown(test.markdown))
+		if actual != test.expected {
+			t.Errorf("Markdown(%q) = %q, expected %q", test.markdown, actual, test.expected)
+		}
+	}
+}
+
+func TestMarkdownEscapesHtml(t *testing.T) {
+	actual := Markdown(`<script>alert(1)</script> **"bold"**`)
+	expected := "<p>&lt;script&gt;alert(1)&lt;/script&gt; <strong>&#34;bold&#34;</strong></p>\n"
+	if actual != expected {
+		t.Errorf("Markdown escaped html as %q, expected %q", actual, expected)
+	}
+}
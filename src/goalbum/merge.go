@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PhotoMetadata is the metadata of a photo which can be edited in
+// photos.json
+type PhotoMetadata struct {
+	Caption string
+	Author  string
+	Tags    []string
+	Order   int
+}
+
+// MergeConflict is a metadata field which was edited in photos.json
+// while its source, such as an album.json sidecar, also changed
+type MergeConflict struct {
+	Photo  string
+	Field  string
+	Edited string
+	Source string
+}
+
+func (c MergeConflict) String() string {
+	return fmt.Sprintf("%s %s: kept edited value %q, source changed to %q", c.Photo, c.Field, c.Edited, c.Source)
+}
+
+// Metadata returns a copy of the editable metadata of the photo
+func (photo *Photo) Metadata() *PhotoMetadata {
+	tags := make([]string, len(photo.Tags))
+	copy(tags, photo.Tags)
+	return &PhotoMetadata{
+		Caption: photo.Caption,
+		Author:  photo.Author,
+		Tags:    tags,
+		Order:   photo.Order,
+	}
+}
+
+// SetGenerated records the current metadata of a freshly indexed photo
+// as its generated metadata, the base of the next merge
+func (photo *Photo) SetGenerated() {
+	photo.Generated = photo.Metadata()
+}
+
+// MergeMetadata merges the metadata of photo2, as edited in photos.json,
+// into photo1, as freshly indexed, field by field. The generated
+// metadata saved with photo2 is the common base:
+//
+// - if the edited value equals the base, it was not edited, and the
+// freshly indexed value is used
+//
+// - if the freshly indexed value equals the base, its source did not
+// change, and the edited value is used, even if it is empty, so values
+// can be cleared deliberately
+//
+// - otherwise both changed, the edited value is kept and a conflict is
+// reported, unless they changed to the same value
+//
+// Photos saved without generated metadata, by older versions of goalbum,
+// have no base, and the edited value is used unless it is empty.
+func (photo1 *Photo) MergeMetadata(photo2 *Photo) []MergeConflict {
+	conflicts := []MergeConflict{}
+	base := photo2.Generated
+
+	conflict := func(field, edited, source string) {
+		conflicts = append(conflicts, MergeConflict{photo1.Filename(), field, edited, source})
+	}
+
+	// caption
+	if base == nil {
+		if photo2.Caption != "" {
+			photo1.Caption = photo2.Caption
+		}
+	} else if photo2.Caption != base.Caption && photo1.Caption != photo2.Caption {
+		if photo1.Caption != base.Caption {
+			conflict("Caption", photo2.Caption, photo1.Caption)
+		}
+		photo1.Caption = photo2.Caption
+	}
+
+	// author
+	if base == nil {
+		if photo2.Author != "" {
+			photo1.Author = photo2.Author
+		}
+	} else if photo2.Author != base.Author && photo1.Author != photo2.Author {
+		if photo1.Author != base.Author {
+			conflict("Author", photo2.Author, photo1.Author)
+		}
+		photo1.Author = photo2.Author
+	}
+
+	// tags
+	if base == nil {
+		if len(photo2.Tags) > 0 {
+			photo1.Tags = photo2.Tags
+		}
+	} else if !tagsEqual(photo2.Tags, base.Tags) && !tagsEqual(photo1.Tags, photo2.Tags) {
+		if !tagsEqual(photo1.Tags, base.Tags) {
+			conflict("Tags", strings.Join(photo2.Tags, ", "), strings.Join(photo1.Tags, ", "))
+		}
+		photo1.Tags = photo2.Tags
+	}
+
+	// order
+	if base == nil {
+		if photo2.Order != 0 {
+			photo1.Order = photo2.Order
+		}
+	} else if photo2.Order != base.Order && photo1.Order != photo2.Order {
+		if photo1.Order != base.Order {
+			conflict("Order", fmt.Sprintf("%d", photo2.Order), fmt.Sprintf("%d", photo1.Order))
+		}
+		photo1.Order = photo2.Order
+	}
+
+	return conflicts
+}
+
+// tagsEqual compares tags in order, treating nil and empty as equal
+func tagsEqual(tags1, tags2 []string) bool {
+	if len(tags1) != len(tags2) {
+		return false
+	}
+	for i := range tags1 {
+		if tags1[i] != tags2[i] {
+			return false
+		}
+	}
+	return true
+}
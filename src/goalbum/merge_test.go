@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMergeMetadataCaption(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		edited   string
+		fresh    string
+		expected string
+		conflict bool
+	}{
+		{"neither changed", "a", "a", "a", "a", false},
+		{"edited, source unchanged", "a", "edited", "a", "edited", false},
+		{"source changed, not edited", "a", "a", "fresh", "fresh", false},
+		{"caption cleared", "a", "", "a", "", false},
+		{"caption cleared in source", "a", "a", "", "", false},
+		{"both changed", "a", "edited", "fresh", "edited", true},
+		{"both changed alike", "a", "same", "same", "same", false},
+		{"cleared while source changed", "a", "", "fresh", "", true},
+	}
+	for _, test := range tests {
+		photo1 := &Photo{InPath: "a.jpg", Caption: test.fresh}
+		photo2 := &Photo{InPath: "a.jpg", Caption: test.edited, Generated: &PhotoMetadata{Caption: test.base}}
+		conflicts := photo1.MergeMetadata(photo2)
+		if photo1.Caption != test.expected {
+			t.Errorf("%s: expected caption %q, got %q", test.name, test.expected, photo1.Caption)
+		}
+		if conflict := len(conflicts) > 0; conflict != test.conflict {
+			t.Errorf("%s: expected conflict %t, got %v", test.name, test.conflict, conflicts)
+		}
+	}
+}
+
+func TestMergeMetadataTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     []string
+		edited   []string
+		fresh    []string
+		expected []string
+		conflict bool
+	}{
+		{"edited, source unchanged", []string{"a"}, []string{"a", "b"}, []string{"a"}, []string{"a", "b"}, false},
+		{"removed in edit", []string{"a", "b"}, []string{"a"}, []string{"a", "b"}, []string{"a"}, false},
+		{"removed in source", []string{"a", "b"}, []string{"a", "b"}, []string{"a"}, []string{"a"}, false},
+		{"all removed in edit", []string{"a"}, []string{}, []string{"a"}, []string{}, false},
+		{"removed on both sides alike", []string{"a", "b"}, []string{"a"}, []string{"a"}, []string{"a"}, false},
+		{"removed on each side", []string{"a", "b"}, []string{"a"}, []string{"b"}, []string{"a"}, true},
+	}
+	for _, test := range tests {
+		photo1 := &Photo{InPath: "a.jpg", Tags: test.fresh}
+		photo2 := &Photo{InPath: "a.jpg", Tags: test.edited, Generated: &PhotoMetadata{Tags: test.base}}
+		conflicts := photo1.MergeMetadata(photo2)
+		if !tagsEqual(photo1.Tags, test.expected) {
+			t.Errorf("%s: expected tags %v, got %v", test.name, test.expected, photo1.Tags)
+		}
+		if conflict := len(conflicts) > 0; conflict != test.conflict {
+			t.Errorf("%s: expected conflict %t, got %v", test.name, test.conflict, conflicts)
+		}
+	}
+}
+
+func TestMergeMetadataConflict(t *testing.T) {
+	photo1 := &Photo{InPath: "2016/a.jpg", Author: "fresh", Order: 2}
+	photo2 := &Photo{InPath: "2016/a.jpg", Author: "edited", Order: 3, Generated: &PhotoMetadata{Author: "base", Order: 1}}
+	conflicts := photo1.MergeMetadata(photo2)
+	if photo1.Author != "edited" || photo1.Order != 3 {
+		t.Errorf("expected edited values to be kept, got %q and %d", photo1.Author, photo1.Order)
+	}
+	expected := []MergeConflict{
+		{"a.jpg", "Author", "edited", "fresh"},
+		{"a.jpg", "Order", "3", "2"},
+	}
+	if len(conflicts) != len(expected) {
+		t.Fatalf("expected conflicts %v, got %v", expected, conflicts)
+	}
+	for i := range expected {
+		if conflicts[i] != expected[i] {
+			t.Errorf("expected conflict %v, got %v", expected[i], conflicts[i])
+		}
+	}
+}
+
+func TestMergeMetadataWithoutBase(t *testing.T) {
+	photo1 := &Photo{InPath: "a.jpg", Caption: "fresh", Author: "fresh", Tags: []string{"fresh"}}
+	photo2 := &Photo{InPath: "a.jpg", Caption: "edited", Tags: []string{}}
+	conflicts := photo1.MergeMetadata(photo2)
+	if photo1.Caption != "edited" {
+		t.Errorf("expected edited caption, got %q", photo1.Caption)
+	}
+	if photo1.Author != "fresh" || !tagsEqual(photo1.Tags, []string{"fresh"}) {
+		t.Errorf("expected empty edited values to be ignored, got %q and %v", photo1.Author, photo1.Tags)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("expected no conflicts, got %v", conflicts)
+	}
+}
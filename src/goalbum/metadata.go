@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	xmpCreatorTool = "goalbum"
+)
+
+// ExportMetadata writes the caption, author and tags of each photo back
+// to its source image, either as an xmp sidecar file or by way of
+// exiftool. Failures are reported per photo, and an error is returned
+// if any photo could not be exported.
+func ExportMetadata(photos []*Photo, mode string) error {
+	var exiftool *Exiftool
+	switch mode {
+	case "xmp":
+	case "exiftool":
+		exifPath, err := ExiftoolPath(*exiftoolFlag)
+		if err != nil {
+			return err
+		}
+		if exifPath == "" {
+			return fmt.Errorf("exiftool not found")
+		}
+		exiftool, err = NewExiftool(exifPath)
+		if err != nil {
+			return err
+		}
+		defer exiftool.Close()
+	default:
+		return fmt.Errorf("Invalid export metadata mode %s", mode)
+	}
+
+	failed := 0
+	for i, photo := range photos {
+		var err error
+		if mode == "xmp" {
+			err = WriteXmpSidecar(photo)
+		} else {
+			_, err = ExifWriteMetadata(exiftool, photo)
+		}
+		if err != nil {
+			fmt.Printf("Error exporting metadata for %s: %s\n", photo.SourcePath(), err.Error())
+			failed += 1
+			continue
+		}
+		fmt.Printf("%d / %d - %s\n", i+1, len(photos), photo.Filename())
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("Unable to export metadata for %d of %d photos", failed, len(photos))
+	}
+	return nil
+}
+
+// XmpSidecarPath returns the path of the xmp sidecar file for the photo,
+// which is the source path with its extension replaced by .xmp
+func XmpSidecarPath(photo *Photo) string {
+	sourcePath := photo.SourcePath()
+	return strings.TrimSuffix(sourcePath, filepath.Ext(sourcePath)) + ".xmp"
+}
+
+// WriteXmpSidecar writes the photo metadata to an xmp sidecar next to
+// the source image. Sidecars that were not written by goalbum are left
+// alone, since they may hold metadata from other tools.
+func WriteXmpSidecar(photo *Photo) error {
+	sidecarPath := XmpSidecarPath(photo)
+
+	existing, err := ioutil.ReadFile(sidecarPath)
+	if err == nil {
+		if !bytes.Contains(existing, []byte(`xmp:CreatorTool="`+xmpCreatorTool+`"`)) {
+			return fmt.Errorf("%s exists and was not written by goalbum, use exiftool mode to update it", sidecarPath)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return ioutil.WriteFile(sidecarPath, XmpSidecar(photo), 0644)
+}
+
+// XmpSidecar returns an xmp packet with the photo caption as
+// dc:description, author as dc:creator and tags as dc:subject
+func XmpSidecar(photo *Photo) []byte {
+	var b bytes.Buffer
+
+	b.WriteString("<?xpacket begin=\"\xef\xbb\xbf\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\"\n")
+	b.WriteString("    xmlns:dc=\"http://purl.org/dc/elements/1.1/\"\n")
+	b.WriteString("    xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\"\n")
+	fmt.Fprintf(&b, "    xmp:CreatorTool=\"%s\">\n", xmpCreatorTool)
+
+	if caption := photo.ExportCaption(); caption != "" {
+		b.WriteString("   <dc:description>\n    <rdf:Alt>\n     <rdf:li xml:lang=\"x-default\">")
+		xml.EscapeText(&b, []byte(caption))
+		b.WriteString("</rdf:li>\n    </rdf:Alt>\n   </dc:description>\n")
+	}
+
+	if photo.Author != "" {
+		b.WriteString("   <dc:creator>\n    <rdf:Seq>\n     <rdf:li>")
+		xml.EscapeText(&b, []byte(photo.Author))
+		b.WriteString("</rdf:li>\n    </rdf:Seq>\n   </dc:creator>\n")
+	}
+
+	if len(photo.Tags) > 0 {
+		b.WriteString("   <dc:subject>\n    <rdf:Bag>\n")
+		for _, tag := range photo.Tags {
+			b.WriteString("     <rdf:li>")
+			xml.EscapeText(&b, []byte(tag))
+			b.WriteString("</rdf:li>\n")
+		}
+		b.WriteString("    </rdf:Bag>\n   </dc:subject>\n")
+	}
+
+	b.WriteString("  </rdf:Description>\n")
+	b.WriteString(" </rdf:RDF>\n")
+	b.WriteString("</x:xmpmeta>\n")
+	b.WriteString("<?xpacket end=\"w\"?>\n")
+
+	return b.Bytes()
+}
+
+// ExifWriteMetadata writes the photo caption, author and tags into the
+// source image using exiftool. Empty values are skipped rather than
+// clearing what the camera recorded, existing keywords are replaced.
+// Values are html escaped, with -E, so multi-line captions keep their
+// line breaks.
+func ExifWriteMetadata(exiftool *Exiftool, photo *Photo) (string, error) {
+	args := []string{"-overwrite_original_in_place", "-E", "-sep", "\x1f"}
+	if caption := exiftoolEscape(photo.ExportCaption()); caption != "" {
+		args = append(args, "-XMP-dc:Description="+caption, "-EXIF:ImageDescription="+caption)
+	}
+	if author := exiftoolEscape(photo.Author); author != "" {
+		args = append(args, "-XMP-dc:Creator="+author, "-EXIF:Artist="+author)
+	}
+	if len(photo.Tags) > 0 {
+		escaped := []string{}
+		for _, tag := range photo.Tags {
+			escaped = append(escaped, exiftoolEscape(tag))
+		}
+		tags := strings.Join(escaped, "\x1f")
+		args = append(args, "-XMP-dc:Subject="+tags, "-IPTC:Keywords="+tags)
+	}
+	args = append(args, photo.SourcePath())
+	return exiftool.Execute(args...)
+}
+
+// exiftoolEscape returns value html escaped for exiftool's -E option,
+// with line breaks as character references, since exiftool arguments are
+// newline delimited
+func exiftoolEscape(value string) string {
+	value = html.EscapeString(value)
+	value = strings.Replace(value, "\r", "&#xd;", -1)
+	return strings.Replace(value, "\n", "&#xa;", -1)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"html/template"
+	"os"
+	"path"
+)
+
+// WritePage renders the template for page to filePath, see PageTemplate
+func WritePage(filePath string, page Page) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	err = indexTmpl.ExecuteTemplate(w, PageTemplate(page), page)
+	if err == nil {
+		err = w.Flush()
+	}
+	cerr := f.Close()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
+
+// WriteTagPages writes a page for each tag in tagsDir, showing the
+// photos with the tag or one of its descendants, and an index page of
+// all tags. page is the gallery index page, whose settings are reused.
+// Pages of tags which no longer exist are removed.
+func WriteTagPages(tagsDir string, page Page, photos []*Photo, tags map[string]string) error {
+	err := os.RemoveAll(tagsDir)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	nodes := FlattenTags(TagTree(tags, TagCooccurrence(photos)))
+	for _, node := range nodes {
+		tagPhotos := []*Photo{}
+		for _, photo := range photos {
+			if SliceContainsString(photo.TagNames, node.Id) {
+				tagPhotos = append(tagPhotos, photo)
+			}
+		}
+		if len(tagPhotos) == 0 {
+			continue
+		}
+		node.Cover = tagPhotos[0]
+
+		// only the tags of the photos on the page can be filtered
+		cooccurrence := TagCooccurrence(tagPhotos)
+		pageTags := map[string]string{}
+		for name, id := range tags {
+			if _, ok := cooccurrence[id]; ok {
+				pageTags[name] = id
+			}
+		}
+		tagsJson, err := json.Marshal(cooccurrence)
+		if err != nil {
+			return err
+		}
+
+		dir := path.Join(tagsDir, node.Slug())
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			return err
+		}
+		tagPage := page
+		tagPage.Root = "../../"
+		tagPage.Tag = node
+		tagPage.Photos = tagPhotos
+		tagPage.Tags = TagTree(pageTags, cooccurrence)
+		tagPage.TagsJson = template.JS(tagsJson)
+		err = WritePages(dir, tagPage)
+		if err != nil {
+			return err
+		}
+	}
+
+	indexPage := page
+	indexPage.Root = "../"
+	indexPage.Photos = []*Photo{}
+	indexPage.Tags = []*TagNode{}
+	indexPage.TagsJson = "{}"
+	indexPage.TagIndex = nodes
+	return WritePage(path.Join(tagsDir, "index.html"), indexPage)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+)
+
+var (
+	// photosPerPage is the number of photos on each page of the gallery,
+	// or 0 for a single page
+	photosPerPage = 0
+
+	// pages within this distance of the current page are linked
+	paginationWindow = 3
+
+	manifestName = "items.json"
+)
+
+// PageLink is a link in the pagination controls. Links without a Url
+// are disabled.
+type PageLink struct {
+	Label  string
+	Url    string
+	Active bool
+}
+
+// ManifestItem is a photo in the manifest of all photos, used by the
+// lightbox to navigate across pages. Paths are relative to the out
+// directory.
+type ManifestItem struct {
+	Pid    string   `json:"pid"`
+	Src    string   `json:"src"`
+	Msrc   string   `json:"msrc"`
+	W      int      `json:"w"`
+	H      int      `json:"h"`
+	Title  string   `json:"title"`
+	Author string   `json:"author"`
+	Tags   []string `json:"tags"`
+}
+
+// SetPhotosPerPage sets the number of photos on each page, 0 for a single
+// page
+func SetPhotosPerPage(n int) error {
+	if n < 0 {
+		return fmt.Errorf("Invalid photos per page %d, expected 0 or more", n)
+	}
+	photosPerPage = n
+	return nil
+}
+
+// PageFilename returns the file name of page n, counting from 1
+func PageFilename(n int) string {
+	if n <= 1 {
+		return "index.html"
+	}
+	return fmt.Sprintf("page-%d.html", n)
+}
+
+// WritePages writes the photos of page to index.html in dir, or, if
+// there are more than photosPerPage, across index.html, page-2.html and
+// so on. Pages left over from a previous, longer gallery are removed.
+func WritePages(dir string, page Page) error {
+	old, err := filepath.Glob(filepath.Join(dir, "page-*.html"))
+	if err != nil {
+		return err
+	}
+	for _, oldPath := range old {
+		err = os.Remove(oldPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	if photosPerPage == 0 || len(page.Photos) <= photosPerPage {
+		page.PageNumber = 1
+		page.PageCount = 1
+		return WritePage(path.Join(dir, PageFilename(1)), page)
+	}
+
+	photos := page.Photos
+	page.PageCount = (len(photos) + photosPerPage - 1) / photosPerPage
+	for i := 0; i < page.PageCount; i++ {
+		end := (i + 1) * photosPerPage
+		if end > len(photos) {
+			end = len(photos)
+		}
+		page.Photos = photos[i*photosPerPage : end]
+		page.PageNumber = i + 1
+		err = WritePage(path.Join(dir, PageFilename(page.PageNumber)), page)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pagination returns the links to the previous and next pages, and to
+// the first, last and nearby pages, with gaps between them
+func (page Page) Pagination() []PageLink {
+	links := []PageLink{}
+	if page.PageCount <= 1 {
+		return links
+	}
+
+	link := func(label string, n int) PageLink {
+		if n < 1 || n > page.PageCount {
+			return PageLink{Label: label}
+		}
+		return PageLink{Label: label, Url: PageFilename(n), Active: n == page.PageNumber}
+	}
+
+	links = append(links, link("‹", page.PageNumber-1))
+	for n := 1; n <= page.PageCount; n++ {
+		near := n >= page.PageNumber-paginationWindow && n <= page.PageNumber+paginationWindow
+		if n == 1 || n == page.PageCount || near {
+			links = append(links, link(strconv.Itoa(n), n))
+		} else if n == page.PageNumber-paginationWindow-1 || n == page.PageNumber+paginationWindow+1 {
+			links = append(links, PageLink{Label: "…"})
+		}
+	}
+	links = append(links, link("›", page.PageNumber+1))
+	return links
+}
+
+// WriteManifest writes the manifest of the photos to the out directory
+func WriteManifest(outDir string, photos []*Photo) error {
+	items := []ManifestItem{}
+	for _, photo := range photos {
+		tags := photo.TagNames
+		if tags == nil {
+			tags = []string{}
+		}
+		items = append(items, ManifestItem{
+			Pid:    photo.Id,
+			Src:    photo.OriginalPath,
+			Msrc:   photo.ThumbPath,
+			W:      photo.SlideWidth,
+			H:      photo.SlideHeight,
+			Title:  photo.Caption,
+			Author: photo.Author,
+			Tags:   tags,
+		})
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(outDir, manifestName), data, 0644)
+}
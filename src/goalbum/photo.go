@@ -3,35 +3,103 @@ package main
 import (
 	"fmt"
 	"path"
+	"path/filepath"
 	"strings"
 	"time"
 )
 
 type Photo struct {
-	Id             string
-	InPath         string
-	Md5sum         string
-	OriginalPath   string
-	OriginalWidth  int
-	OriginalHeight int
-	SlidePath      string
-	SlideWidth     int
-	SlideHeight    int
-	ThumbPath      string
-	ThumbWidth     int
-	ThumbHeight    int
-	Caption        string
-	Author         string
-	Tags           []string
-	TagNames       []string
-	CreatedAt      time.Time
+	Id              string
+	InPath          string
+	Md5sum          string
+	OriginalPath    string
+	OriginalWidth   int
+	OriginalHeight  int
+	SlidePath       string
+	SlideWidth      int
+	SlideHeight     int
+	ThumbPath       string
+	ThumbWidth      int
+	ThumbHeight     int
+	Caption         string
+	Author          string
+	Tags            []string
+	AutoTags        []string
+	TagNames        []string
+	CreatedAt       time.Time
+	CreatedAtSource string
+	CreatedAtZone   string
+	ClockOffset     string
+	CameraMake      string
+	CameraModel     string
+	CameraSerial    string
+	LensModel       string
+	Latitude        float64
+	Longitude       float64
+	LocationSource  string
+	Monochrome      bool
+	Event           string
+	Hidden          bool
+	Order           int
+	Generated       *PhotoMetadata
 }
 
 func (photo *Photo) Filename() string {
-	return path.Base(photo.InPath)
+	return path.Base(filepath.ToSlash(photo.InPath))
 }
 
-func (photo1 *Photo) Update(photo2 *Photo) {
+// SourcePath returns the path of the source image. InPath is relative
+// to the input directory, unless the image is outside of it.
+func (photo *Photo) SourcePath() string {
+	if filepath.IsAbs(photo.InPath) {
+		return photo.InPath
+	}
+	return filepath.Join(inputRoot, filepath.FromSlash(photo.InPath))
+}
+
+// CheckSourcePaths returns an error if a photo source path is relative to
+// an input directory which is not known
+func CheckSourcePaths(photos []*Photo) error {
+	if inputRoot != "" {
+		return nil
+	}
+	for _, photo := range photos {
+		if !filepath.IsAbs(photo.InPath) {
+			return fmt.Errorf("%s is relative to the input directory, set it with -in", photo.InPath)
+		}
+	}
+	return nil
+}
+
+// InDir returns the directory of the photo relative to the input
+// directory, slash separated, or an empty string if the photo is
+// directly in, or outside of, the input directory
+func (photo *Photo) InDir() string {
+	if filepath.IsAbs(photo.InPath) {
+		return ""
+	}
+	dir := path.Dir(filepath.ToSlash(photo.InPath))
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// RelativeInPath returns absPath relative to root, slash separated, or
+// absPath if it is not under root
+func RelativeInPath(root, absPath string) string {
+	rel, err := filepath.Rel(root, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return absPath
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Update fills in values of photo1, freshly indexed, from photo2, read
+// from photos.json, and merges their metadata. See MergeMetadata.
+func (photo1 *Photo) Update(photo2 *Photo) []MergeConflict {
+	conflicts := photo1.MergeMetadata(photo2)
+
 	if photo1.OriginalWidth == 0 && photo2.OriginalWidth != 0 {
 		photo1.OriginalWidth = photo2.OriginalWidth
 	}
@@ -50,41 +118,60 @@ func (photo1 *Photo) Update(photo2 *Photo) {
 	if photo1.ThumbHeight == 0 && photo2.ThumbHeight != 0 {
 		photo1.ThumbHeight = photo2.ThumbHeight
 	}
-	if photo1.Caption == "" && photo2.Caption != "" {
-		photo1.Caption = photo2.Caption
+	if !photo1.Monochrome && photo2.Monochrome {
+		// monochrome is detected when images are generated
+		photo1.Monochrome = true
 	}
-	if photo1.Author == "" && photo2.Author != "" {
-		photo1.Author = photo2.Author
+	if photo1.Event == "" {
+		// the event is kept so its edited title follows the photos
+		photo1.Event = photo2.Event
 	}
-	if len(photo1.Tags) == 0 && len(photo2.Tags) > 0 {
-		photo1.Tags = photo2.Tags
+	if photo1.LocationSource == "" && photo2.LocationSource != "" && photo2.LocationSource != LocationGpx {
+		// gpx positions are inferred again on every run, so a corrected
+		// offset or track replaces them
+		photo1.Latitude = photo2.Latitude
+		photo1.Longitude = photo2.Longitude
+		photo1.LocationSource = photo2.LocationSource
 	}
+	return conflicts
+}
+
+func (photo *Photo) DefaultCaption() string {
+	return fmt.Sprintf("%s: %s", photo.Filename(), photo.CreatedAt.Format("Monday, January 2, 2006 at 3:04pm"))
 }
 
 func (photo *Photo) SetDefaultCaption() {
 	if photo.Caption == "" {
-		photo.Caption = fmt.Sprintf("%s: %s", photo.Filename(), photo.CreatedAt.Format("Monday, January 2, 2006 at 3:04pm"))
+		photo.Caption = photo.DefaultCaption()
 	}
 }
 
-func (photo *Photo) TagsStr() string {
-	return strings.Join(photo.Tags, " ")
-}
-
-func (photo *Photo) TagNamesStr() string {
-	return strings.Join(photo.TagNames, " ")
+// ExportCaption returns the caption, or an empty string if the caption
+// is the generated default
+func (photo *Photo) ExportCaption() string {
+	if photo.Caption == photo.DefaultCaption() {
+		return ""
+	}
+	return photo.Caption
 }
 
-type ByCreatedAt []*Photo
-
-func (p ByCreatedAt) Len() int {
-	return len(p)
+// AllTags returns the photo's tags followed by its automatic tags
+func (photo *Photo) AllTags() []string {
+	tags := []string{}
+	for _, list := range [][]string{photo.Tags, photo.AutoTags} {
+		for _, tag := range list {
+			if !SliceContainsString(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
 }
 
-func (p ByCreatedAt) Swap(i, j int) {
-	p[i], p[j] = p[j], p[i]
+func (photo *Photo) TagsStr() string {
+	return strings.Join(photo.Tags, " ")
 }
 
-func (p ByCreatedAt) Less(i, j int) bool {
-	return p[i].CreatedAt.Before(p[j].CreatedAt)
+func (photo *Photo) TagNamesStr() string {
+	return strings.Join(photo.TagNames, " ")
 }
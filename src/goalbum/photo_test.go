@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUpdateLocation(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{LocationExif, LocationExif},
+		{"manual", "manual"},
+		{LocationGpx, ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		photo := &Photo{Md5sum: "abc"}
+		existing := &Photo{Md5sum: "abc", Latitude: 48.85, Longitude: 2.35, LocationSource: test.source}
+		photo.Update(existing)
+		if photo.LocationSource != test.expected {
+			t.Errorf("existing %q location: expected source %q, got %q", test.source, test.expected, photo.LocationSource)
+		}
+		if test.expected == "" && (photo.Latitude != 0 || photo.Longitude != 0) {
+			t.Errorf("existing %q location: expected no position, got %g, %g", test.source, photo.Latitude, photo.Longitude)
+		}
+	}
+}
+
+func TestUpdateKeepsFreshGpxLocation(t *testing.T) {
+	photo := &Photo{Md5sum: "abc", Latitude: 1, Longitude: 2, LocationSource: LocationGpx}
+	existing := &Photo{Md5sum: "abc", Latitude: 3, Longitude: 4, LocationSource: LocationGpx}
+	photo.Update(existing)
+	if photo.Latitude != 1 || photo.Longitude != 2 {
+		t.Errorf("expected the position inferred this run, got %g, %g", photo.Latitude, photo.Longitude)
+	}
+}
+
+func TestCheckSourcePaths(t *testing.T) {
+	defer func(root string) { inputRoot = root }(inputRoot)
+	photos := []*Photo{{InPath: "/photos/a.jpg"}, {InPath: "2016/b.jpg"}}
+
+	inputRoot = ""
+	if err := CheckSourcePaths(photos[:1]); err != nil {
+		t.Errorf("expected absolute paths to be accepted, got %s", err.Error())
+	}
+	if err := CheckSourcePaths(photos); err == nil {
+		t.Error("expected an error for a relative path without an input directory")
+	}
+
+	inputRoot = "/photos"
+	if err := CheckSourcePaths(photos); err != nil {
+		t.Errorf("expected relative paths to be accepted, got %s", err.Error())
+	}
+}
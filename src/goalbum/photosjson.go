@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PhotosJsonVersion is the schema version of photos.json written by
+// this version of goalbum. It must be incremented, and a migration
+// added to photosJsonMigrations, whenever a field is renamed or its
+// meaning changes.
+const PhotosJsonVersion = 2
+
+// PhotosJson is the content of photos.json
+type PhotosJson struct {
+	SchemaVersion    int
+	GeneratorVersion string
+	Album            map[string]json.RawMessage
+	Events           map[string]string
+	Photos           []*Photo
+}
+
+// photosJsonMigrations upgrade the decoded json of one schema version to
+// the next, indexed by the version they upgrade from
+var photosJsonMigrations = []func(dir string, doc map[string]json.RawMessage) error{
+	migratePhotosJsonV0,
+	migratePhotosJsonV1,
+}
+
+// legacyConfigName is the file album settings were saved in before they
+// moved into photos.json
+const legacyConfigName = "goalbum.json"
+
+// migratePhotosJsonV0 upgrades a bare array of photos, along with the
+// album settings in goalbum.json if there are any, to the envelope.
+// goalbum.json is removed once photos.json is written.
+func migratePhotosJsonV0(dir string, doc map[string]json.RawMessage) error {
+	legacyConfigPath := filepath.Join(dir, legacyConfigName)
+	data, err := ioutil.ReadFile(legacyConfigPath)
+	if err == nil {
+		doc["Album"] = json.RawMessage(data)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// migratePhotosJsonV1 makes absolute photo InPaths relative to the
+// album's input directory. Galleries without a saved input directory use
+// the -in flag, or else the deepest directory holding every photo.
+func migratePhotosJsonV1(dir string, doc map[string]json.RawMessage) error {
+	var album struct {
+		In string `json:"in"`
+	}
+	if raw, ok := doc["Album"]; ok {
+		err := json.Unmarshal(raw, &album)
+		if err != nil {
+			return err
+		}
+	}
+
+	rawPhotos, ok := doc["Photos"]
+	if !ok {
+		return nil
+	}
+	var photos []map[string]json.RawMessage
+	err := json.Unmarshal(rawPhotos, &photos)
+	if err != nil {
+		return err
+	}
+	inPaths := make([]string, len(photos))
+	absPaths := []string{}
+	for i, photo := range photos {
+		if _, ok := photo["InPath"]; !ok {
+			continue
+		}
+		err = json.Unmarshal(photo["InPath"], &inPaths[i])
+		if err != nil {
+			return err
+		}
+		if filepath.IsAbs(inPaths[i]) {
+			absPaths = append(absPaths, inPaths[i])
+		}
+	}
+	if len(absPaths) == 0 {
+		return nil
+	}
+
+	root := album.In
+	if root == "" && *inFlag != "" {
+		root, err = filepath.Abs(*inFlag)
+		if err != nil {
+			return err
+		}
+	}
+	if root == "" {
+		root = commonDir(absPaths)
+	}
+	if album.In == "" {
+		err = recordAlbumIn(doc, root)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, photo := range photos {
+		if _, ok := photo["InPath"]; !ok {
+			continue
+		}
+		photo["InPath"], err = json.Marshal(RelativeInPath(root, inPaths[i]))
+		if err != nil {
+			return err
+		}
+	}
+	doc["Photos"], err = json.Marshal(photos)
+	return err
+}
+
+// recordAlbumIn sets the input directory of the album config, so the
+// paths made relative by a migration can be resolved without -in
+func recordAlbumIn(doc map[string]json.RawMessage, root string) error {
+	album := map[string]json.RawMessage{}
+	if raw, ok := doc["Album"]; ok && string(raw) != "null" {
+		err := json.Unmarshal(raw, &album)
+		if err != nil {
+			return err
+		}
+	}
+	var err error
+	album["in"], err = json.Marshal(root)
+	if err != nil {
+		return err
+	}
+	doc["Album"], err = json.Marshal(album)
+	return err
+}
+
+// commonDir returns the deepest directory which contains every one of
+// the absolute paths
+func commonDir(paths []string) string {
+	dir := filepath.Dir(paths[0])
+	for _, p := range paths[1:] {
+		for dir != filepath.Dir(dir) && !strings.HasPrefix(p, dir+string(filepath.Separator)) {
+			dir = filepath.Dir(dir)
+		}
+	}
+	return dir
+}
+
+// ReadPhotosJson reads an existing photos.json file, migrating older
+// schema versions. A missing file is not an error and results in no
+// photos.
+func ReadPhotosJson(photoJsonPath string) (*PhotosJson, error) {
+	photosBlob, err := ioutil.ReadFile(photoJsonPath)
+	if os.IsNotExist(err) {
+		return &PhotosJson{SchemaVersion: PhotosJsonVersion, Photos: []*Photo{}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	doc := map[string]json.RawMessage{}
+	photosBlob = bytes.TrimSpace(photosBlob)
+	if bytes.HasPrefix(photosBlob, []byte("[")) {
+		// before versioning photos.json was a bare array of photos
+		doc["SchemaVersion"] = json.RawMessage("0")
+		doc["Photos"] = json.RawMessage(photosBlob)
+	} else {
+		err = json.Unmarshal(photosBlob, &doc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rawVersion, ok := doc["SchemaVersion"]
+	if !ok {
+		return nil, fmt.Errorf("%s has no schema version", photoJsonPath)
+	}
+	var version int
+	err = json.Unmarshal(rawVersion, &version)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid schema version: %s", err.Error())
+	}
+	if version < 0 {
+		return nil, fmt.Errorf("%s has invalid schema version %d", photoJsonPath, version)
+	}
+	if version > PhotosJsonVersion {
+		return nil, fmt.Errorf("%s has schema version %d, but this version of goalbum only supports up to version %d, please upgrade goalbum", photoJsonPath, version, PhotosJsonVersion)
+	}
+
+	for ; version < PhotosJsonVersion; version++ {
+		err = photosJsonMigrations[version](filepath.Dir(photoJsonPath), doc)
+		if err != nil {
+			return nil, fmt.Errorf("Migrating %s from schema version %d: %s", photoJsonPath, version, err.Error())
+		}
+		doc["SchemaVersion"] = json.RawMessage(fmt.Sprintf("%d", version+1))
+	}
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var photosJson PhotosJson
+	err = json.Unmarshal(migrated, &photosJson)
+	if err != nil {
+		return nil, err
+	}
+	if photosJson.Photos == nil {
+		photosJson.Photos = []*Photo{}
+	}
+
+	return &photosJson, nil
+}
+
+// WritePhotosJson writes photos.json with the current schema version,
+// album settings and event titles, then removes the goalbum.json it
+// supersedes
+func WritePhotosJson(photoJsonPath string, photos []*Photo, events map[string]string) error {
+	album := map[string]json.RawMessage{}
+	for name, value := range persistedFlags() {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		album[name] = data
+	}
+
+	data, err := json.MarshalIndent(PhotosJson{
+		SchemaVersion:    PhotosJsonVersion,
+		GeneratorVersion: buildVersion,
+		Album:            album,
+		Events:           events,
+		Photos:           photos,
+	}, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(photoJsonPath, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filepath.Join(filepath.Dir(photoJsonPath), legacyConfigName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeAlbumFiles writes the named files to a new temporary directory,
+// which the caller must remove
+func writeAlbumFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "goalbum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestReadPhotosJsonBareArray(t *testing.T) {
+	dir := writeAlbumFiles(t, map[string]string{
+		"photos.json": `[{"Id": "photo-a", "InPath": "a.jpg", "Caption": "A"}]`,
+	})
+	defer os.RemoveAll(dir)
+
+	photosJson, err := ReadPhotosJson(filepath.Join(dir, "photos.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if photosJson.SchemaVersion != PhotosJsonVersion {
+		t.Errorf("expected schema version %d, got %d", PhotosJsonVersion, photosJson.SchemaVersion)
+	}
+	if len(photosJson.Album) != 0 {
+		t.Errorf("expected no album settings, got %v", photosJson.Album)
+	}
+	if len(photosJson.Photos) != 1 || photosJson.Photos[0].Id != "photo-a" || photosJson.Photos[0].Caption != "A" {
+		t.Errorf("expected photo-a, got %v", photosJson.Photos)
+	}
+}
+
+func TestReadPhotosJsonFoldsLegacyConfig(t *testing.T) {
+	dir := writeAlbumFiles(t, map[string]string{
+		"photos.json":    `[{"Id": "photo-a", "InPath": "a.jpg"}]`,
+		legacyConfigName: `{"title": "Holiday", "max-thumb": 300}`,
+	})
+	defer os.RemoveAll(dir)
+
+	photosJson, err := ReadPhotosJson(filepath.Join(dir, "photos.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := string(photosJson.Album["title"]); title != `"Holiday"` {
+		t.Errorf("expected title from %s, got %s", legacyConfigName, title)
+	}
+	if maxThumb := string(photosJson.Album["max-thumb"]); maxThumb != "300" {
+		t.Errorf("expected max-thumb from %s, got %s", legacyConfigName, maxThumb)
+	}
+	if len(photosJson.Photos) != 1 {
+		t.Errorf("expected one photo, got %d", len(photosJson.Photos))
+	}
+}
+
+func TestReadPhotosJsonInvalidVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		message string
+	}{
+		{"negative", `{"SchemaVersion": -1, "Photos": []}`, "invalid schema version -1"},
+		{"future", `{"SchemaVersion": 1000, "Photos": []}`, "please upgrade goalbum"},
+		{"missing", `{"Photos": []}`, "has no schema version"},
+		{"not a number", `{"SchemaVersion": "1", "Photos": []}`, "Invalid schema version"},
+	}
+	for _, test := range tests {
+		dir := writeAlbumFiles(t, map[string]string{"photos.json": test.json})
+		_, err := ReadPhotosJson(filepath.Join(dir, "photos.json"))
+		os.RemoveAll(dir)
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.message, err)
+		}
+	}
+}
+
+func TestReadPhotosJsonRecordsInputDirectory(t *testing.T) {
+	tests := []struct {
+		name  string
+		album string
+		in    string
+	}{
+		{"common directory", `{"title": "Holiday"}`, `"/photos"`},
+		{"no album settings", `null`, `"/photos"`},
+		{"saved input directory", `{"title": "Holiday", "in": "/"}`, `"/"`},
+	}
+	for _, test := range tests {
+		dir := writeAlbumFiles(t, map[string]string{
+			"photos.json": `{"SchemaVersion": 1, "Album": ` + test.album + `, "Photos": [
+				{"Id": "photo-a", "InPath": "/photos/2016/a.jpg"},
+				{"Id": "photo-b", "InPath": "/photos/2017/b.jpg"}
+			]}`,
+		})
+		photosJson, err := ReadPhotosJson(filepath.Join(dir, "photos.json"))
+		os.RemoveAll(dir)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err.Error())
+		}
+		if in := string(photosJson.Album["in"]); in != test.in {
+			t.Errorf("%s: expected input directory %s, got %s", test.name, test.in, in)
+		}
+		if test.album != "null" && string(photosJson.Album["title"]) != `"Holiday"` {
+			t.Errorf("%s: expected title to be kept, got %s", test.name, photosJson.Album["title"])
+		}
+		root := strings.Trim(test.in, `"`)
+		for i, expected := range []string{"/photos/2016/a.jpg", "/photos/2017/b.jpg"} {
+			inPath := photosJson.Photos[i].InPath
+			if filepath.IsAbs(inPath) || filepath.Join(root, inPath) != expected {
+				t.Errorf("%s: expected %s relative to %s, got %s", test.name, expected, root, inPath)
+			}
+		}
+	}
+}
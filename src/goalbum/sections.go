@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	GroupNone  = ""
+	GroupDay   = "day"
+	GroupMonth = "month"
+	GroupYear  = "year"
+)
+
+// group layouts are the section key, title and timeline label layouts
+// of each grouping
+var groupLayouts = map[string][3]string{
+	GroupDay:   {"2006-01-02", "Monday, 2 January 2006", "2 Jan 2006"},
+	GroupMonth: {"2006-01", "January 2006", "Jan 2006"},
+	GroupYear:  {"2006", "2006", "2006"},
+}
+
+// PhotoSection is a group of consecutive photos in the gallery, captured
+// on the same day, month or year, or in the same event. Id is its html
+// id, Title its heading and Label its name in the timeline.
+type PhotoSection struct {
+	Id     string
+	Title  string
+	Label  string
+	Photos []*Photo
+}
+
+// ValidateGroup returns an error if group is not a valid grouping
+func ValidateGroup(group string) error {
+	if _, ok := groupLayouts[group]; ok || group == GroupNone || group == GroupEvent {
+		return nil
+	}
+	return fmt.Errorf("Invalid group %s, expected one of day, month, year, event", group)
+}
+
+// GroupPhotos groups consecutive photos captured in the same day, month
+// or year, or in the same event, into sections. Without grouping, all
+// photos are in a single section without title.
+func GroupPhotos(photos []*Photo, group string) []*PhotoSection {
+	if group == GroupEvent {
+		return GroupEvents(photos)
+	}
+
+	sections := []*PhotoSection{}
+	layouts, ok := groupLayouts[group]
+	if !ok {
+		if len(photos) > 0 {
+			sections = append(sections, &PhotoSection{Id: "section-all", Photos: photos})
+		}
+		return sections
+	}
+
+	ids := map[string]bool{}
+	var section *PhotoSection
+	var key string
+	for _, photo := range photos {
+		photoKey := photo.CreatedAt.Format(layouts[0])
+		if section == nil || photoKey != key {
+			// photos sorted other than by date may return to a section
+			id := "section-" + photoKey
+			for i := 2; ids[id]; i++ {
+				id = fmt.Sprintf("section-%s-%d", photoKey, i)
+			}
+			ids[id] = true
+
+			key = photoKey
+			section = &PhotoSection{
+				Id:     id,
+				Title:  photo.CreatedAt.Format(layouts[1]),
+				Label:  photo.CreatedAt.Format(layouts[2]),
+				Photos: []*Photo{},
+			}
+			sections = append(sections, section)
+		}
+		section.Photos = append(section.Photos, photo)
+	}
+	return sections
+}
+
+// Sections returns the photos of the page grouped by page.Group. Photos
+// are grouped across the whole gallery, so sections split across pages,
+// or shown on tag pages, keep their ids and titles.
+func (page Page) Sections() []*PhotoSection {
+	if page.sections == nil {
+		return GroupPhotos(page.Photos, page.Group)
+	}
+
+	onPage := map[*Photo]bool{}
+	for _, photo := range page.Photos {
+		onPage[photo] = true
+	}
+	sections := []*PhotoSection{}
+	for _, section := range page.sections {
+		photos := []*Photo{}
+		for _, photo := range section.Photos {
+			if onPage[photo] {
+				photos = append(photos, photo)
+			}
+		}
+		if len(photos) > 0 {
+			sections = append(sections, &PhotoSection{
+				Id:     section.Id,
+				Title:  section.Title,
+				Label:  section.Label,
+				Photos: photos,
+			})
+		}
+	}
+	return sections
+}
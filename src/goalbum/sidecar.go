@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var (
+	albumSidecarName = "album.json"
+
+	// sidecars in other formats are not read, but are reported so they
+	// aren't silently ignored
+	unsupportedSidecarNames = []string{"album.yaml", "album.yml"}
+)
+
+// AlbumSidecar is the metadata in an album.json file in an input
+// directory. Defaults apply to every photo in the directory and its
+// sub-directories, unless a deeper album.json overrides them. Order
+// lists file names in manual order.
+type AlbumSidecar struct {
+	Defaults AlbumSidecarPhoto
+	Order    []string
+	Photos   map[string]AlbumSidecarPhoto
+}
+
+// AlbumSidecarPhoto is the metadata for a single file in an album.json
+type AlbumSidecarPhoto struct {
+	Caption string
+	Author  string
+	Tags    []string
+	Hidden  bool
+	Order   int
+}
+
+// ReadAlbumSidecar reads the album.json in dir. A missing file is not an
+// error and results in nil. Only json sidecars are supported.
+func ReadAlbumSidecar(dir string) (*AlbumSidecar, error) {
+	sidecarPath := filepath.Join(dir, albumSidecarName)
+	data, err := ioutil.ReadFile(sidecarPath)
+	if os.IsNotExist(err) {
+		for _, name := range unsupportedSidecarNames {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				fmt.Printf("Warning: ignoring %s, only %s sidecars are supported\n", filepath.Join(dir, name), albumSidecarName)
+			}
+		}
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var sidecar AlbumSidecar
+	err = json.Unmarshal(data, &sidecar)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", sidecarPath, err.Error())
+	}
+	return &sidecar, nil
+}
+
+// ApplyAlbumSidecars merges the metadata from album.json files under
+// root into photos. Values from the sidecars replace indexed values,
+// tags from defaults are added to the photo's own tags.
+func ApplyAlbumSidecars(root string, photos []*Photo) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	sidecars := map[string]*AlbumSidecar{}
+	readSidecar := func(dir string) (*AlbumSidecar, error) {
+		if sidecar, ok := sidecars[dir]; ok {
+			return sidecar, nil
+		}
+		sidecar, err := ReadAlbumSidecar(dir)
+		if err != nil {
+			return nil, err
+		}
+		sidecars[dir] = sidecar
+		return sidecar, nil
+	}
+
+	for _, photo := range photos {
+		dir := filepath.Dir(photo.SourcePath())
+
+		// collect directories from the photo's up to root
+		dirs := []string{dir}
+		for dir != absRoot {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				// photo is not under root
+				dirs = dirs[:1]
+				break
+			}
+			dir = parent
+			dirs = append(dirs, dir)
+		}
+
+		// apply defaults from root down
+		for i := len(dirs) - 1; i >= 0; i-- {
+			sidecar, err := readSidecar(dirs[i])
+			if err != nil {
+				return err
+			}
+			if sidecar != nil {
+				photo.ApplySidecar(sidecar.Defaults)
+			}
+		}
+
+		sidecar, err := readSidecar(dirs[0])
+		if err != nil {
+			return err
+		}
+		if sidecar == nil {
+			continue
+		}
+		for i, name := range sidecar.Order {
+			if name == photo.Filename() {
+				photo.Order = i + 1
+			}
+		}
+		if meta, ok := sidecar.Photos[photo.Filename()]; ok {
+			photo.ApplySidecar(meta)
+		}
+	}
+
+	return nil
+}
+
+// ApplySidecar sets the non-empty values of meta on the photo
+func (photo *Photo) ApplySidecar(meta AlbumSidecarPhoto) {
+	if meta.Caption != "" {
+		photo.Caption = meta.Caption
+	}
+	if meta.Author != "" {
+		photo.Author = meta.Author
+	}
+	for _, tag := range meta.Tags {
+		if !SliceContainsString(photo.Tags, tag) {
+			photo.Tags = append(photo.Tags, tag)
+		}
+	}
+	if meta.Hidden {
+		photo.Hidden = true
+	}
+	if meta.Order != 0 {
+		photo.Order = meta.Order
+	}
+}
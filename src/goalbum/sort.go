@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	SortDate     = "date"
+	SortFilename = "filename"
+	SortPath     = "path"
+	SortManual   = "manual"
+
+	// sortReverse is appended to date, filename or path to reverse them
+	sortReverse = "-reverse"
+)
+
+var (
+	// sortOrder is the order of photos in the gallery
+	sortOrder = SortDate
+)
+
+// SetSortOrder sets the order of photos in the gallery. One of date,
+// filename, path or manual, where all but manual can be reversed, such
+// as date-reverse.
+func SetSortOrder(str string) error {
+	switch str {
+	case SortDate, SortFilename, SortPath, SortManual,
+		SortDate + sortReverse, SortFilename + sortReverse, SortPath + sortReverse:
+		sortOrder = str
+		return nil
+	}
+	return fmt.Errorf("Invalid sort order %s, expected one of date, filename, path, manual, or date, filename, path followed by -reverse", str)
+}
+
+// SortPhotos sorts the photos by sortOrder. Photos which are equal in
+// that order are sorted by capture time, path and content, so the order
+// is the same each time the gallery is generated.
+//
+// In manual order, photos with an Order come first, by Order, followed by
+// the rest by capture time.
+func SortPhotos(photos []*Photo) {
+	order := strings.TrimSuffix(sortOrder, sortReverse)
+	reverse := order != sortOrder
+
+	sort.SliceStable(photos, func(i, j int) bool {
+		p1, p2 := photos[i], photos[j]
+		if reverse {
+			p1, p2 = p2, p1
+		}
+
+		c := 0
+		switch order {
+		case SortFilename:
+			c = naturalCompare(p1.Filename(), p2.Filename())
+		case SortPath:
+			c = naturalCompare(p1.InPath, p2.InPath)
+		case SortManual:
+			c = compareOrder(p1.Order, p2.Order)
+		}
+		if c == 0 {
+			c = compareTime(p1, p2)
+		}
+		if c == 0 {
+			c = naturalCompare(p1.InPath, p2.InPath)
+		}
+		if c == 0 {
+			c = strings.Compare(p1.Md5sum, p2.Md5sum)
+		}
+		return c < 0
+	})
+}
+
+func compareTime(p1, p2 *Photo) int {
+	switch {
+	case p1.CreatedAt.Before(p2.CreatedAt):
+		return -1
+	case p1.CreatedAt.After(p2.CreatedAt):
+		return 1
+	}
+	return 0
+}
+
+// compareOrder compares manual orders, where 0 is unordered and sorts
+// after any order
+func compareOrder(o1, o2 int) int {
+	switch {
+	case o1 == o2:
+		return 0
+	case o2 == 0:
+		return -1
+	case o1 == 0:
+		return 1
+	case o1 < o2:
+		return -1
+	}
+	return 1
+}
+
+// naturalCompare compares strings case insensitively, with runs of
+// digits compared by their numeric value, so that IMG_9.jpg sorts before
+// IMG_10.jpg
+func naturalCompare(s1, s2 string) int {
+	c1, c2 := naturalChunks(strings.ToLower(s1)), naturalChunks(strings.ToLower(s2))
+	for i := 0; i < len(c1) && i < len(c2); i++ {
+		a, b := c1[i], c2[i]
+		if isDigit(a[0]) && isDigit(b[0]) {
+			// compare by length without leading zeros, then by digits
+			ta, tb := strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+			if len(ta) != len(tb) {
+				if len(ta) < len(tb) {
+					return -1
+				}
+				return 1
+			}
+			if c := strings.Compare(ta, tb); c != 0 {
+				return c
+			}
+		} else if c := strings.Compare(a, b); c != 0 {
+			return c
+		}
+	}
+	if len(c1) != len(c2) {
+		if len(c1) < len(c2) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(s1, s2)
+}
+
+// naturalChunks splits str into runs of digits and of other characters
+func naturalChunks(str string) []string {
+	chunks := []string{}
+	start := 0
+	for i := 1; i < len(str); i++ {
+		if isDigit(str[i]) != isDigit(str[i-1]) {
+			chunks = append(chunks, str[start:i])
+			start = i
+		}
+	}
+	if start < len(str) {
+		chunks = append(chunks, str[start:])
+	}
+	return chunks
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
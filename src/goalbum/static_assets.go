@@ -7,16 +7,25 @@ import (
 	"path/filepath"
 )
 
-//go:generate go-bindata -pkg $GOPACKAGE -o assets.go -prefix "templates/" templates/ templates/js/ templates/css/ templates/css/default-skin/ templates/fonts/ templates/fonts/roboto/
+//go:generate go-bindata -pkg $GOPACKAGE -o assets.go -prefix "templates/" templates/ templates/js/ templates/css/ templates/css/default-skin/ templates/fonts/ templates/fonts/roboto/ templates/themes/
 
 var (
-	staticAssets = []string{
+	// appAssets are the script and stylesheet of every theme
+	appAssets = []string{
 		"js/app.js",
 		"css/app.css",
+	}
+
+	// photoswipeAssets are the lightbox skin
+	photoswipeAssets = []string{
 		"css/default-skin/default-skin.css",
 		"css/default-skin/preloader.gif",
 		"css/default-skin/default-skin.svg",
 		"css/default-skin/default-skin.png",
+	}
+
+	// fontAssets are the fonts used by app.css
+	fontAssets = []string{
 		"fonts/roboto/Roboto-Medium.eot",
 		"fonts/roboto/Roboto-Regular.woff",
 		"fonts/roboto/Roboto-Regular.ttf",
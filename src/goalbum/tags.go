@@ -0,0 +1,143 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+var (
+	// tags containing the separator form a hierarchy, e.g. People/Alice
+	tagSeparator = "/"
+)
+
+// TagNode is a tag in the hierarchy of tags. Name is the last part of
+// the tag, Path the full tag and Id its css class in the gallery. Count
+// is the number of photos with the tag or one of its descendants, Cover
+// the first of them, when tag pages are written.
+type TagNode struct {
+	Name     string
+	Path     string
+	Id       string
+	Count    int
+	Cover    *Photo
+	Children []*TagNode
+}
+
+// Slug returns the directory name of the tag's page, its css class
+// without prefix
+func (node *TagNode) Slug() string {
+	return strings.TrimPrefix(node.Id, "tag-")
+}
+
+// TagAncestors returns the tag followed by each of its parent tags,
+// from the nearest up. Empty parts of the tag are ignored.
+func TagAncestors(tag string) []string {
+	parts := []string{}
+	for _, part := range strings.Split(tag, tagSeparator) {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	ancestors := []string{}
+	for i := len(parts); i > 0; i-- {
+		ancestors = append(ancestors, strings.Join(parts[:i], tagSeparator))
+	}
+	return ancestors
+}
+
+// TagSlug returns the tag in lower case, with each run of characters
+// other than letters and digits replaced by a dash
+func TagSlug(tag string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(tag) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "tag"
+	}
+	return b.String()
+}
+
+// TagCooccurrence counts the photos having each pair of tags, by css
+// class, after SetTagNames. The count of a tag with itself is the
+// number of photos having the tag.
+func TagCooccurrence(photos []*Photo) map[string]map[string]int {
+	counts := map[string]map[string]int{}
+	for _, photo := range photos {
+		for _, id1 := range photo.TagNames {
+			if _, ok := counts[id1]; !ok {
+				counts[id1] = map[string]int{}
+			}
+			for _, id2 := range photo.TagNames {
+				counts[id1][id2] += 1
+			}
+		}
+	}
+	return counts
+}
+
+// TagTree arranges the tags returned by PhotoTags into a tree, sorted by
+// name at each level, and returns the top level tags. Counts are taken
+// from TagCooccurrence.
+func TagTree(tags map[string]string, cooccurrence map[string]map[string]int) []*TagNode {
+	nodes := map[string]*TagNode{}
+	roots := []*TagNode{}
+
+	paths := MapKeys(tags)
+	// parents sort before their children
+	sort.Strings(paths)
+	for _, path := range paths {
+		ancestors := TagAncestors(path)
+		if len(ancestors) == 0 || ancestors[0] != path {
+			continue
+		}
+		node := &TagNode{
+			Name:     path[strings.LastIndex(path, tagSeparator)+1:],
+			Path:     path,
+			Id:       tags[path],
+			Count:    cooccurrence[tags[path]][tags[path]],
+			Children: []*TagNode{},
+		}
+		nodes[path] = node
+		if len(ancestors) == 1 {
+			roots = append(roots, node)
+		} else if parent, ok := nodes[ancestors[1]]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+
+	sortTagNodes(roots)
+	return roots
+}
+
+func sortTagNodes(nodes []*TagNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	for _, node := range nodes {
+		sortTagNodes(node.Children)
+	}
+}
+
+// FlattenTags returns the tags of the tree depth first, parents before
+// their children
+func FlattenTags(nodes []*TagNode) []*TagNode {
+	flat := []*TagNode{}
+	for _, node := range nodes {
+		flat = append(flat, node)
+		flat = append(flat, FlattenTags(node.Children)...)
+	}
+	return flat
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// templateFuncs are available to every template
+	templateFuncs = template.FuncMap{
+		"date":        formatDate,
+		"urlescape":   url.PathEscape,
+		"queryescape": url.QueryEscape,
+		"json":        toJson,
+		"markdown":    markdownHtml,
+	}
+
+	// templateExt is the extension of files in the template directory
+	templateExt = ".ctmpl"
+)
+
+// PagePhoto is a photo along with the relative path from its page to the
+// out directory, passed to the photo template
+type PagePhoto struct {
+	*Photo
+	Root string
+}
+
+// Item returns the photo along with the page's root, for the photo
+// template
+func (page Page) Item(photo *Photo) PagePhoto {
+	return PagePhoto{photo, page.Root}
+}
+
+// ParseTemplates parses the embedded index template, then the templates
+// of the theme, then each template file in dir, if not empty. A file
+// defines the template named by its file name without extensions, such as
+// index.html.ctmpl for index or photo.ctmpl for photo, and may define
+// more templates with define actions. Templates defined in dir replace
+// the theme's, which replace the embedded ones.
+func ParseTemplates(t *Theme, dir string) (*template.Template, error) {
+	tmpl, err := template.New("index").Funcs(templateFuncs).Parse(string(indexCtmpl))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range t.Templates {
+		_, err = tmpl.New(name).Parse(string(MustAsset(name)))
+		if err != nil {
+			return nil, fmt.Errorf("theme %s: %s", t.Name, err.Error())
+		}
+	}
+	if dir == "" {
+		return tmpl, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+templateExt))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s has no %s files", dir, templateExt)
+	}
+	for _, templatePath := range paths {
+		data, err := ioutil.ReadFile(templatePath)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(templatePath)
+		name = name[:strings.Index(name, ".")]
+		if name == "" {
+			return nil, fmt.Errorf("%s: template file names must start with the template name", templatePath)
+		}
+		_, err = tmpl.New(name).Parse(string(data))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tmpl, nil
+}
+
+// PageTemplate returns the name of the template which renders page:
+// tag-index for the tag index, tag for tag pages, otherwise index
+func PageTemplate(page Page) string {
+	switch {
+	case page.TagIndex != nil:
+		return "tag-index"
+	case page.Tag != nil:
+		return "tag"
+	}
+	return "index"
+}
+
+// ReadContentFile returns the content of the file at path, or an empty
+// string if path is empty. The content is trusted html, inserted into
+// pages without escaping.
+func ReadContentFile(path string) (template.HTML, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(data), nil
+}
+
+func formatDate(layout string, t time.Time) string {
+	return t.Format(layout)
+}
+
+// toJson returns v encoded as json, which is inserted into scripts
+// as is and escaped elsewhere
+func toJson(v interface{}) (template.JS, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return template.JS(data), nil
+}
+
+// markdownHtml returns str converted to html, which escapes any html in
+// str, so it is inserted into pages as is
+func markdownHtml(str string) template.HTML {
+	return template.HTML(Markdown(str))
+}
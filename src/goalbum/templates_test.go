@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const hostile = `"><script>alert(1)</script></small>`
+
+// renderHostilePage renders a page whose photo has a hostile caption,
+// author and tags with the default theme
+func renderHostilePage(t *testing.T) string {
+	photo := &Photo{
+		Id:           "photo-a",
+		InPath:       "a.jpg",
+		OriginalPath: "originals/a.jpg",
+		ThumbPath:    "thumbs/a.jpg",
+		SlidePath:    "slides/a.jpg",
+		Caption:      hostile,
+		Author:       hostile,
+		Tags:         []string{hostile, `it's "quoted"`},
+		CreatedAt:    time.Date(2016, 10, 11, 12, 0, 0, 0, time.UTC),
+	}
+	photos := []*Photo{photo}
+	tags := PhotoTags(photos)
+	SetTagNames(photos, tags)
+
+	// tag ids are slugs, so a hostile key can only come from elsewhere
+	cooccurrence := TagCooccurrence(photos)
+	cooccurrence[hostile] = map[string]int{hostile: 1}
+	tagsJson, err := json.Marshal(cooccurrence)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := ParseTemplates(themes["default"], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := Page{
+		Title:      hostile,
+		Photos:     photos,
+		Theme:      themes["default"],
+		Tags:       TagTree(tags, cooccurrence),
+		TagsJson:   template.JS(tagsJson),
+		PageNumber: 1,
+		PageCount:  1,
+	}
+	var b bytes.Buffer
+	err = tmpl.ExecuteTemplate(&b, PageTemplate(page), page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestHostileTextIsEscaped(t *testing.T) {
+	out := renderHostilePage(t)
+
+	escaped := `&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;&lt;/small&gt;`
+	for _, want := range []string{
+		`data-caption="` + escaped + `"`,
+		`data-author="` + escaped + `"`,
+		`title="` + escaped + `"`,
+		`title="it&#39;s &#34;quoted&#34;"`,
+		`<title>` + escaped + `</title>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %s", want)
+		}
+	}
+
+	if strings.Contains(out, "<script>alert(1)") || strings.Contains(out, "</small>") {
+		t.Error("expected no unescaped markup from photo text")
+	}
+}
+
+func TestHostileTagClasses(t *testing.T) {
+	out := renderHostilePage(t)
+
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.Contains(line, `data-photo-id="photo-a"`) {
+			continue
+		}
+		start := strings.Index(line, `class="`) + len(`class="`)
+		end := strings.Index(line[start:], `"`)
+		for _, class := range strings.Fields(line[start : start+end]) {
+			if strings.Trim(class, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+				t.Errorf("expected photo class %q to be a slug", class)
+			}
+		}
+		return
+	}
+	t.Error("expected output to contain photo")
+}
+
+func TestHostileTagCooccurrenceScript(t *testing.T) {
+	out := renderHostilePage(t)
+
+	if !strings.Contains(out, `"\"\u003e\u003cscript\u003ealert(1)\u003c/script\u003e\u003c/small\u003e"`) {
+		t.Error("expected tag cooccurrence keys to be escaped in the script")
+	}
+	if strings.Count(out, "</script>") != strings.Count(out, "<script") {
+		t.Error("expected tag cooccurrence not to close its script")
+	}
+}
+
+func TestContentIsNotEscaped(t *testing.T) {
+	tmpl, err := ParseTemplates(themes["default"], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := Page{
+		Theme:       themes["default"],
+		HeadContent: template.HTML(`<style>body { color: red; }</style>`),
+		BodyContent: template.HTML(`<script>track();</script>`),
+		TagsJson:    template.JS("{}"),
+	}
+	var b bytes.Buffer
+	err = tmpl.ExecuteTemplate(&b, "index", page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{string(page.HeadContent), string(page.BodyContent)} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("expected output to contain %s", want)
+		}
+	}
+}
+
+func TestParseTemplatesWithoutName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goalbum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, templateExt), []byte("<p>no name</p>"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseTemplates(themes["default"], dir)
+	if err == nil {
+		t.Errorf("expected an error for %s", templateExt)
+	}
+}
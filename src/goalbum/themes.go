@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// LayoutWall galleries are laid out by freewall
+	LayoutWall = "wall"
+	// LayoutFlow galleries are laid out by the theme's stylesheets
+	LayoutFlow = "flow"
+)
+
+// Theme is a built in look of the gallery. Templates are embedded
+// template files parsed after the index template, replacing the templates
+// they define. Stylesheets are the assets linked from the head of each
+// page. Assets are the static assets written to the assets directory.
+type Theme struct {
+	Name        string
+	Layout      string
+	Templates   []string
+	Stylesheets []string
+	Assets      []string
+}
+
+var (
+	themes = map[string]*Theme{
+		"default": &Theme{
+			Name:        "default",
+			Layout:      LayoutWall,
+			Templates:   []string{},
+			Stylesheets: []string{"css/app.css", "css/default-skin/default-skin.css"},
+			Assets:      joinAssets(appAssets, photoswipeAssets, fontAssets),
+		},
+		"dark": &Theme{
+			Name:        "dark",
+			Layout:      LayoutWall,
+			Templates:   []string{"themes/dark.ctmpl"},
+			Stylesheets: []string{"css/app.css", "css/default-skin/default-skin.css", "themes/dark.css"},
+			Assets:      joinAssets(appAssets, photoswipeAssets, fontAssets, []string{"themes/dark.css"}),
+		},
+		"justified": &Theme{
+			Name:        "justified",
+			Layout:      LayoutFlow,
+			Templates:   []string{"themes/justified.ctmpl"},
+			Stylesheets: []string{"css/app.css", "css/default-skin/default-skin.css", "themes/justified.css"},
+			Assets:      joinAssets(appAssets, photoswipeAssets, fontAssets, []string{"themes/justified.css"}),
+		},
+		"story": &Theme{
+			Name:        "story",
+			Layout:      LayoutFlow,
+			Templates:   []string{"themes/story.ctmpl"},
+			Stylesheets: []string{"css/app.css", "css/default-skin/default-skin.css", "themes/story.css"},
+			Assets:      joinAssets(appAssets, photoswipeAssets, fontAssets, []string{"themes/story.css"}),
+		},
+		// print has no lightbox, and sets its own fonts
+		"print": &Theme{
+			Name:        "print",
+			Layout:      LayoutFlow,
+			Templates:   []string{"themes/print.ctmpl"},
+			Stylesheets: []string{"css/app.css", "themes/print.css"},
+			Assets:      joinAssets(appAssets, []string{"themes/print.css"}),
+		},
+	}
+
+	// theme is the theme of the gallery
+	theme = themes["default"]
+)
+
+func joinAssets(lists ...[]string) []string {
+	assets := []string{}
+	for _, list := range lists {
+		assets = append(assets, list...)
+	}
+	return assets
+}
+
+// ThemeNames returns the names of the built in themes, sorted
+func ThemeNames() []string {
+	names := []string{}
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetTheme sets the theme of the gallery by name
+func SetTheme(name string) error {
+	t, ok := themes[name]
+	if !ok {
+		return fmt.Errorf("Invalid theme %s, expected one of %s", name, strings.Join(ThemeNames(), ", "))
+	}
+	theme = t
+	return nil
+}
+
+// WriteThemeAssets replaces the assets directory with the static assets
+// of the theme, so no assets of a theme used before are left behind
+func WriteThemeAssets(assetsDir string, t *Theme) error {
+	err := os.RemoveAll(assetsDir)
+	if err != nil {
+		return err
+	}
+	for _, staticAsset := range t.Assets {
+		err = writeStaticAsset(assetsDir, staticAsset)
+		if err != nil {
+			return fmt.Errorf("%s: %s", staticAsset, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+var (
+	exifTimeLayout = "2006:01:02 15:04:05"
+
+	// timezone is used for capture times which were recorded without one
+	timezone = time.Local
+
+	// dateSources is the order in which capture time sources are tried
+	dateSources = []string{DateExif, DateFilename, DateModTime}
+
+	// dateLayouts are custom layouts used to parse file names
+	dateLayouts = []string{}
+
+	// matches dates in file names such as IMG_20160101_123456.jpg,
+	// PXL_20160101_123456789.jpg, Screenshot_2016-01-01-12-34-56.png,
+	// IMG-20160101-WA0001.jpg or 2016-01-01 12.34.56.jpg
+	filenameDateRegexp = regexp.MustCompile(`(?:^|[^0-9])((?:19|20)[0-9]{2})[-_.]?([0-9]{2})[-_.]?([0-9]{2})(?:[-_ T.]?([0-9]{2})[-_.:]?([0-9]{2})[-_.:]?([0-9]{2}))?`)
+
+	// matches capture dates in xmp sidecars
+	xmpDateRegexp = regexp.MustCompile(`(?:exif:DateTimeOriginal|photoshop:DateCreated|xmp:CreateDate)(?:="|>)([^"<]+)`)
+
+	xmpDateLayouts = []string{
+		"2006-01-02T15:04:05.999999999Z07:00",
+		"2006-01-02T15:04:05Z07:00",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04",
+		"2006-01-02",
+	}
+)
+
+// sources of a photo's CreatedAt
+const (
+	DateExif     = "exif"
+	DateFilename = "filename"
+	DateSidecar  = "sidecar"
+	DateModTime  = "mtime"
+	DateNow      = "now"
+)
+
+// sources of the time zone of a photo's CreatedAt
+const (
+	ZoneOffsetTimeOriginal = string(OffsetTimeOriginal)
+	ZoneOffsetTime         = string(OffsetTime)
+	ZoneGPS                = "GPS"
+	ZoneSidecar            = "sidecar"
+	ZoneTimezoneFlag       = "timezone"
+	ZoneLocal              = "local"
+)
+
+// SetTimezone sets the time zone used for capture times which were
+// recorded without one. An empty name means the local time zone.
+func SetTimezone(name string) error {
+	if name == "" {
+		timezone = time.Local
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return err
+	}
+	timezone = loc
+	return nil
+}
+
+// SetDateSources sets the order in which capture time sources are
+// tried, from a comma separated list, along with custom file name
+// layouts
+func SetDateSources(str string, layouts []string) error {
+	sources := []string{}
+	for _, source := range strings.Split(str, ",") {
+		source = strings.TrimSpace(source)
+		switch source {
+		case DateExif, DateFilename, DateSidecar, DateModTime:
+			sources = append(sources, source)
+		case "":
+		default:
+			return fmt.Errorf("Invalid date source %s, expected one of exif, filename, sidecar, mtime", source)
+		}
+	}
+	dateSources = sources
+	dateLayouts = layouts
+	return nil
+}
+
+// ImageTimeTaken returns the time the image was captured, along with
+// the source of the time and of its time zone. Sources are tried in the
+// order given to SetDateSources, falling back to the current time.
+func ImageTimeTaken(path string) (time.Time, string, string) {
+	for _, source := range dateSources {
+		var timeTaken time.Time
+		var zone string
+		var err error
+		switch source {
+		case DateExif:
+			timeTaken, zone, err = FileExifTimeTaken(path)
+		case DateFilename:
+			timeTaken, zone, err = FilenameTimeTaken(path)
+		case DateSidecar:
+			timeTaken, zone, err = SidecarTimeTaken(path)
+		case DateModTime:
+			timeTaken, zone, err = ModTimeTaken(path)
+		}
+		if err == nil && !timeTaken.IsZero() {
+			return timeTaken, source, zone
+		}
+	}
+
+	loc, zone := wallZone()
+	return time.Now().In(loc), DateNow, zone
+}
+
+// FileExifTimeTaken returns the capture time recorded in the exif data
+// of the image at path
+func FileExifTimeTaken(path string) (time.Time, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	defer f.Close()
+
+	x, err := exif.Decode(f)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	return ExifTimeTaken(x)
+}
+
+// FilenameTimeTaken parses the capture time from the file name, first
+// with the custom layouts, then by looking for a date such as the ones
+// written by phones and screenshot tools
+func FilenameTimeTaken(path string) (time.Time, string, error) {
+	base := filepath.Base(path)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	loc, zone := wallZone()
+
+	for _, layout := range dateLayouts {
+		t, err := time.ParseInLocation(layout, base, loc)
+		if err == nil {
+			return t, zone, nil
+		}
+	}
+
+	m := filenameDateRegexp.FindStringSubmatch(base)
+	if m == nil {
+		return time.Time{}, "", fmt.Errorf("No date in file name %s", base)
+	}
+	nums := make([]int, 6)
+	for i, str := range m[1:] {
+		if str != "" {
+			nums[i], _ = strconv.Atoi(str)
+		}
+	}
+	t := time.Date(nums[0], time.Month(nums[1]), nums[2], nums[3], nums[4], nums[5], 0, loc)
+	// reject dates which time.Date normalized, such as month 13
+	if t.Month() != time.Month(nums[1]) || t.Day() != nums[2] || t.Hour() != nums[3] || t.Minute() != nums[4] || t.Second() != nums[5] {
+		return time.Time{}, "", fmt.Errorf("Invalid date in file name %s", base)
+	}
+	return t, zone, nil
+}
+
+// SidecarTimeTaken reads the capture time from an xmp sidecar, or from
+// the json sidecar written by google takeout
+func SidecarTimeTaken(path string) (time.Time, string, error) {
+	xmpPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".xmp"
+	for _, p := range []string{xmpPath, path + ".xmp"} {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		m := xmpDateRegexp.FindSubmatch(data)
+		if m == nil {
+			continue
+		}
+		for _, layout := range xmpDateLayouts {
+			if strings.Contains(layout, "Z07:00") {
+				t, err := time.Parse(layout, string(m[1]))
+				if err == nil {
+					return t, ZoneSidecar, nil
+				}
+			} else {
+				loc, zone := wallZone()
+				t, err := time.ParseInLocation(layout, string(m[1]), loc)
+				if err == nil {
+					return t, zone, nil
+				}
+			}
+		}
+	}
+
+	data, err := ioutil.ReadFile(path + ".json")
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	var takeout struct {
+		PhotoTakenTime struct {
+			Timestamp string `json:"timestamp"`
+		} `json:"photoTakenTime"`
+	}
+	err = json.Unmarshal(data, &takeout)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	seconds, err := strconv.ParseInt(takeout.PhotoTakenTime.Timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	loc, zone := wallZone()
+	return time.Unix(seconds, 0).In(loc), zone, nil
+}
+
+// ModTimeTaken returns the modification time of the file
+func ModTimeTaken(path string) (time.Time, string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	loc, zone := wallZone()
+	return fi.ModTime().In(loc), zone, nil
+}
+
+// wallZone returns the time zone for times recorded without one, and
+// its source
+func wallZone() (*time.Location, string) {
+	if *timezoneFlag != "" {
+		return timezone, ZoneTimezoneFlag
+	}
+	return timezone, ZoneLocal
+}
+
+// ExifTimeTaken returns the capture time recorded in exif data, and the
+// source of its time zone
+func ExifTimeTaken(x *exif.Exif) (time.Time, string, error) {
+	offsetField := OffsetTimeOriginal
+	tag, err := x.Get(exif.DateTimeOriginal)
+	if err != nil {
+		offsetField = OffsetTime
+		tag, err = x.Get(exif.DateTime)
+	}
+	if err != nil {
+		// gps time is better than nothing
+		gpsTime, err := ExifGPSTime(x)
+		if err != nil {
+			return time.Time{}, "", err
+		}
+		return gpsTime, ZoneGPS, nil
+	}
+
+	dateStr, err := exifString(tag)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	// wall clock time, as read from the camera
+	wall, err := time.ParseInLocation(exifTimeLayout, dateStr, time.UTC)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	if offset, err := ExifOffset(x, offsetField); err == nil {
+		return inZone(wall, time.FixedZone("", offset)), string(offsetField), nil
+	}
+	if offset, err := ExifOffset(x, OffsetTime); err == nil {
+		return inZone(wall, time.FixedZone("", offset)), string(OffsetTime), nil
+	}
+
+	if gpsTime, err := ExifGPSTime(x); err == nil {
+		// gps time is utc, round the difference to the nearest quarter
+		// hour to allow for a camera clock which has drifted
+		offset := wall.Sub(gpsTime).Round(15 * time.Minute)
+		if offset >= -14*time.Hour && offset <= 14*time.Hour {
+			return inZone(wall, time.FixedZone("", int(offset/time.Second))), ZoneGPS, nil
+		}
+	}
+
+	loc, zone := wallZone()
+	return inZone(wall, loc), zone, nil
+}
+
+// ExifOffset parses an exif offset field, formatted as +HH:MM or Z, into
+// seconds east of utc
+func ExifOffset(x *exif.Exif, field exif.FieldName) (int, error) {
+	tag, err := x.Get(field)
+	if err != nil {
+		return 0, err
+	}
+	str, err := exifString(tag)
+	if err != nil {
+		return 0, err
+	}
+	t, err := time.Parse("Z07:00", str)
+	if err != nil {
+		return 0, err
+	}
+	_, offset := t.Zone()
+	return offset, nil
+}
+
+// ExifGPSTime returns the utc time recorded by the gps receiver
+func ExifGPSTime(x *exif.Exif) (time.Time, error) {
+	dateTag, err := x.Get(exif.GPSDateStamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	dateStr, err := exifString(dateTag)
+	if err != nil {
+		return time.Time{}, err
+	}
+	date, err := time.Parse("2006:01:02", dateStr)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	timeTag, err := x.Get(exif.GPSTimeStamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var seconds float64
+	for i, unit := range []float64{3600, 60, 1} {
+		num, den, err := timeTag.Rat2(i)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if den == 0 {
+			return time.Time{}, fmt.Errorf("Invalid gps time stamp")
+		}
+		seconds += float64(num) / float64(den) * unit
+	}
+
+	return date.Add(time.Duration(seconds * float64(time.Second))), nil
+}
+
+// inZone returns the time with the same wall clock as t, in loc
+func inZone(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+func exifString(tag *tiff.Tag) (string, error) {
+	if tag.Format() != tiff.StringVal {
+		return "", fmt.Errorf("Exif tag is not a string")
+	}
+	return strings.TrimSpace(strings.TrimRight(string(tag.Val), "\x00")), nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilenameTimeTaken(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"IMG_20160104_235959.jpg", "2016-01-04 23:59:59"},
+		{"Screenshot 2016-01-04 10.11.12.jpg", "2016-01-04 10:11:12"},
+		{"trip/20160104.jpg", "2016-01-04 00:00:00"},
+	}
+	for _, test := range tests {
+		actual, _, err := FilenameTimeTaken(test.path)
+		if err != nil {
+			t.Errorf("%s: %s", test.path, err.Error())
+			continue
+		}
+		if actual.Format("2006-01-02 15:04:05") != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.path, test.expected, actual.Format("2006-01-02 15:04:05"))
+		}
+	}
+}
+
+func TestFilenameTimeTakenInvalid(t *testing.T) {
+	for _, path := range []string{
+		"IMG_20160104_235961.jpg",
+		"IMG_20160104_236059.jpg",
+		"IMG_20160104_245959.jpg",
+		"IMG_20160230_120000.jpg",
+		"IMG_20161304_120000.jpg",
+		"IMG_0042.jpg",
+	} {
+		actual, _, err := FilenameTimeTaken(path)
+		if err == nil {
+			t.Errorf("%s: expected an error, got %s", path, actual.Format(time.RFC3339))
+		}
+	}
+}
@@ -7,8 +7,8 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strconv"
-	"time"
 
 	"github.com/disintegration/imaging"
 	"github.com/rwcarlsen/goexif/exif"
@@ -38,6 +38,48 @@ func GetOrientation(path string) (int, error) {
 	return val, nil
 }
 
+// GetCamera returns the make, model and serial number of the camera
+// which took the image. Missing fields are empty.
+func GetCamera(path string) (cameraMake, cameraModel, cameraSerial, lensModel string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	x, err := exif.Decode(f)
+	if err != nil {
+		return
+	}
+
+	fields := []exif.FieldName{exif.Make, exif.Model, BodySerialNumber, exif.LensModel}
+	values := []*string{&cameraMake, &cameraModel, &cameraSerial, &lensModel}
+	for i, field := range fields {
+		tag, err := x.Get(field)
+		if err != nil {
+			continue
+		}
+		*values[i], _ = exifString(tag)
+	}
+	return
+}
+
+// GetLatLong returns the gps position recorded in the image exif data
+func GetLatLong(path string) (float64, float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	x, err := exif.Decode(f)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return x.LatLong()
+}
+
 // FixOrientation modifies image in-place to match exif orientation data
 // http://sylvana.net/jpegcrop/exif_orientation.html
 func FixOrientation(img *image.Image, orientation int) error {
@@ -73,33 +115,6 @@ func FixOrientation(img *image.Image, orientation int) error {
 	return nil
 }
 
-func ImageTimeTaken(path string) time.Time {
-	f, err := os.Open(path)
-	if err != nil {
-		return time.Now()
-	}
-
-	var timeTaken time.Time
-
-	x, err := exif.Decode(f)
-	if err == nil {
-		timeTaken, _ = x.DateTime()
-	}
-
-	if timeTaken.IsZero() {
-		fi, err := f.Stat()
-		if err == nil {
-			timeTaken = fi.ModTime()
-		}
-	}
-
-	if timeTaken.IsZero() {
-		timeTaken = time.Now()
-	}
-
-	return timeTaken
-}
-
 func Md5sumFromPath(path string) (string, error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -147,14 +162,36 @@ CheckPhotos:
 	return result
 }
 
-func PhotoUpdate(photos1, photos2 []*Photo) {
+func PhotoIntersect(photos1, photos2 []*Photo) []*Photo {
+	return PhotoSliceSubtract(photos1, PhotoSliceSubtract(photos1, photos2))
+}
+
+// VisiblePhotos returns the photos which are not hidden
+func VisiblePhotos(photos []*Photo) []*Photo {
+	result := []*Photo{}
+	for _, photo := range photos {
+		if !photo.Hidden {
+			result = append(result, photo)
+		}
+	}
+	return result
+}
+
+// HiddenPhotos returns the photos which are hidden
+func HiddenPhotos(photos []*Photo) []*Photo {
+	return PhotoSliceSubtract(photos, VisiblePhotos(photos))
+}
+
+func PhotoUpdate(photos1, photos2 []*Photo) []MergeConflict {
+	conflicts := []MergeConflict{}
 	for _, photo1 := range photos1 {
 		for _, photo2 := range photos2 {
 			if photo1.Md5sum == photo2.Md5sum {
-				photo1.Update(photo2)
+				conflicts = append(conflicts, photo1.Update(photo2)...)
 			}
 		}
 	}
+	return conflicts
 }
 
 func PhotoUnion(photos1, photos2 []*Photo) []*Photo {
@@ -194,28 +231,47 @@ func CopyFile(dst, src string) error {
 	return cerr
 }
 
+// PhotoTags returns the css class of each tag of the photos, including
+// the parents of hierarchical tags. Classes are derived from the tag
+// names, so they stay the same when photos are added or removed.
 func PhotoTags(photos []*Photo) map[string]string {
 	tags := make(map[string]string)
-
-	var i int = 0
 	for _, photo := range photos {
-		for _, tag := range photo.Tags {
-			if _, ok := tags[tag]; !ok {
-				tags[tag] = "tag-" + strconv.Itoa(i)
-				i += 1
+		for _, tag := range photo.AllTags() {
+			for _, ancestor := range TagAncestors(tag) {
+				tags[ancestor] = ""
 			}
 		}
 	}
 
+	// tags whose names slugify alike are numbered in sorted order
+	names := MapKeys(tags)
+	sort.Strings(names)
+	ids := map[string]bool{}
+	for _, name := range names {
+		id := "tag-" + TagSlug(name)
+		for i := 2; ids[id]; i++ {
+			id = "tag-" + TagSlug(name) + "-" + strconv.Itoa(i)
+		}
+		ids[id] = true
+		tags[name] = id
+	}
+
 	return tags
 }
 
+// SetTagNames sets the css classes of the photos' tags and their parents,
+// so that filtering by a parent tag matches all of its descendants
 func SetTagNames(photos []*Photo, tags map[string]string) {
 	for _, photo := range photos {
-		if len(photo.Tags) > 0 {
-			tagNames := make([]string, len(photo.Tags))
-			for i, tag := range photo.Tags {
-				tagNames[i] = tags[tag]
+		if len(photo.AllTags()) > 0 {
+			tagNames := []string{}
+			for _, tag := range photo.AllTags() {
+				for _, ancestor := range TagAncestors(tag) {
+					if !SliceContainsString(tagNames, tags[ancestor]) {
+						tagNames = append(tagNames, tags[ancestor])
+					}
+				}
 			}
 			photo.TagNames = tagNames
 		}
@@ -243,6 +299,15 @@ func FindPhotoByMd5sum(photos []*Photo, md5sum string) *Photo {
 	return nil
 }
 
+func FindPhotoById(photos []*Photo, id string) *Photo {
+	for _, photo := range photos {
+		if photo.Id == id {
+			return photo
+		}
+	}
+	return nil
+}
+
 func SetPhotoIds(photos []*Photo) error {
 	md5sums := []string{}
 	ids := []string{}